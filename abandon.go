@@ -0,0 +1,99 @@
+package mpool
+
+import (
+	"log"
+	"time"
+)
+
+// hold records borrowed item for abandonment check, it must be called with
+// mu held
+func (pool *base[T]) hold(e *entry[T]) {
+	if pool.abandonAfter <= 0 {
+		return
+	}
+	if pool.lent == nil {
+		pool.lent = make(map[*entry[T]]time.Time)
+	}
+	if _, ok := pool.lent[e]; !ok {
+		pool.lent[e] = pool.now()
+	}
+}
+
+// unhold forgets returned item, it must be called with mu held
+func (pool *base[T]) unhold(e *entry[T]) {
+	delete(pool.lent, e)
+}
+
+// takeAbandoned reclaims slots of items borrowed longer than abandon timeout,
+// it must be called with mu held
+func (pool *base[T]) takeAbandoned() []removal[T] {
+	if pool.abandonAfter <= 0 || len(pool.lent) == 0 {
+		return nil
+	}
+	now := pool.now()
+	var removed []removal[T]
+	for e, since := range pool.lent {
+		if now.Sub(since) < pool.abandonAfter {
+			continue
+		}
+		delete(pool.lent, e)
+		pool.unwatch(e)
+		pool.unborrow(e)
+		// lease keeps the entry, item returned with Put is remembered
+		e.abandoned = true
+		if key, ok := itemKey(e.value); ok {
+			pool.remember(key)
+		}
+		pool.giveback()
+		pool.current--
+		removed = append(removed, removal[T]{e: e, reason: DestroyAbandoned})
+	}
+	if len(removed) > 0 {
+		pool.notify()
+	}
+	return removed
+}
+
+// remember records key of reclaimed item, only the latest reclaimed items up
+// to the limit of live items are kept. It must be called with mu held.
+func (pool *base[T]) remember(key any) {
+	if uint(len(pool.reclaimed)) >= pool.max {
+		copy(pool.reclaimed, pool.reclaimed[1:])
+		pool.reclaimed = pool.reclaimed[:len(pool.reclaimed)-1]
+	}
+	pool.reclaimed = append(pool.reclaimed, key)
+}
+
+// wasReclaimed reports if returned item was reclaimed as abandoned and
+// forgets it, it must be called with mu held
+func (pool *base[T]) wasReclaimed(item T) bool {
+	if len(pool.reclaimed) == 0 {
+		return false
+	}
+	key, ok := itemKey(item)
+	if !ok {
+		return false
+	}
+	for i, k := range pool.reclaimed {
+		if k == key {
+			copy(pool.reclaimed[i:], pool.reclaimed[i+1:])
+			pool.reclaimed[len(pool.reclaimed)-1] = nil
+			pool.reclaimed = pool.reclaimed[:len(pool.reclaimed)-1]
+			return true
+		}
+	}
+	return false
+}
+
+// stale reports if returned item was already reclaimed as abandoned, such
+// item is ignored. It must be called with mu held and it releases mu if item
+// is stale.
+func (pool *base[T]) stale(e *entry[T]) bool {
+	if !e.abandoned {
+		return false
+	}
+	pool.wasReclaimed(e.value)
+	pool.mu.Unlock()
+	log.Println("mpool: item returned after it was reclaimed as abandoned is ignored")
+	return true
+}
@@ -0,0 +1,1031 @@
+package mpool
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxCheckAttempts limits how many invalid idle items are released during
+	// one Get before new item is created instead
+	maxCheckAttempts = 3
+
+	// minCleanInterval limits how often background cleaner checks idle items
+	minCleanInterval = 100 * time.Millisecond
+
+	// lifetimeJitter is the largest fraction of max lifetime which is cut off
+	// randomly for every item, so items created together do not expire together
+	lifetimeJitter = 0.1
+
+	// minFillBackoff and maxFillBackoff bound delay of background refill
+	// after factory failure, the delay is doubled on every failure in a row
+	minFillBackoff = 100 * time.Millisecond
+	maxFillBackoff = 10 * time.Second
+)
+
+// entry is item with metadata tracked by the pool
+type entry[T any] struct {
+	value   T
+	created time.Time
+	since   time.Time // when item was returned to the pool
+	uses    uint      // how many times item was handed out
+	jitter  float64   // fraction of max lifetime cut off for the item
+	checked time.Time // when idle item was validated in background
+	lent    bool      // item is borrowed and not returned yet
+	// item was reclaimed while borrowed, it is ignored when returned
+	abandoned bool
+}
+
+// info describes item for hooks
+func (e *entry[T]) info(now time.Time) ItemInfo {
+	return ItemInfo{
+		Created: e.created,
+		Age:     now.Sub(e.created),
+		Uses:    e.uses,
+	}
+}
+
+// removal is item taken out of the pool to be released
+type removal[T any] struct {
+	e      *entry[T]
+	reason DestroyReason
+}
+
+// base holds state shared by limited and unlimited pools, fields are guarded by mu
+type base[T any] struct {
+	stats         counters
+	hooks         atomic.Value // *Hooks[T]
+	new           Factory[T]
+	release       func(T)
+	check         func(T) bool
+	clock         Clock // nil for system clock
+	mu            sync.Mutex
+	idle          []*entry[T]         // ordered by since, the oldest first
+	borrowed      map[any][]*entry[T] // borrowed items which can be used as map key
+	current       uint                // live items: idle and borrowed
+	inuse         uint
+	max           uint // limit of live items, zero for unlimited pool
+	closed        bool
+	waiters       []*waiter[T]  // blocked Get calls in arrival order
+	aging         time.Duration // waiting time which raises waiter priority by one class
+	maxWaiters    uint          // zero for unlimited wait queue
+	shed          shedder
+	drained       chan struct{} // closed when last borrowed item is returned to closed pool
+	cleaner       chan struct{} // wakes up background cleaner, nil if cleaner is not running
+	maxIdle       uint
+	maxIdleTime   time.Duration
+	maxLifetime   time.Duration
+	maxUses       uint
+	minIdle       uint
+	strategy      IdleStrategy
+	strict        bool // Put and Discard reject items which are not borrowed
+	detect        bool // leak detector records borrowers
+	watched       map[*entry[T]]*borrow
+	leakThreshold time.Duration
+	lent          map[*entry[T]]time.Time // when items were borrowed, for abandonment check
+	abandonAfter  time.Duration
+	reclaimed     []any              // keys of the latest items reclaimed as abandoned
+	validateEvery time.Duration      // how often idle items are validated in background
+	validateCount uint               // how many idle items are validated at once
+	validated     time.Time          // when idle items were validated last time
+	skipValidated bool               // Get skips check of recently validated item
+	filler        chan struct{}      // wakes up background refill, nil if refill is not running
+	fillerStop    context.CancelFunc // cancels factory call of background refill
+	fillerDone    chan struct{}      // closed when background refill exits
+}
+
+// now returns current time of the pool clock
+func (pool *base[T]) now() time.Time {
+	if pool.clock == nil {
+		return time.Now()
+	}
+	return pool.clock.Now()
+}
+
+// newEntry wraps just created item
+func (pool *base[T]) newEntry(item T) *entry[T] {
+	return &entry[T]{
+		value:   item,
+		created: pool.now(),
+		jitter:  rand.Float64() * lifetimeJitter,
+	}
+}
+
+// pushIdle adds item to idle list, it must be called with mu held
+func (pool *base[T]) pushIdle(e *entry[T]) {
+	e.since = pool.now()
+	pool.idle = append(pool.idle, e)
+}
+
+// popIdle takes idle item selected by idle strategy, it must be called with
+// mu held
+func (pool *base[T]) popIdle() (*entry[T], bool) {
+	n := len(pool.idle)
+	if n == 0 {
+		return nil, false
+	}
+	var e *entry[T]
+	switch pool.strategy {
+	case IdleLIFO:
+		e = pool.idle[n-1]
+		pool.idle[n-1] = nil
+		pool.idle = pool.idle[:n-1]
+	case IdleRandom:
+		i := rand.Intn(n)
+		e = pool.idle[i]
+		copy(pool.idle[i:], pool.idle[i+1:])
+		pool.idle[n-1] = nil
+		pool.idle = pool.idle[:n-1]
+	default:
+		e = pool.idle[0]
+		pool.idle[0] = nil
+		pool.idle = pool.idle[1:]
+	}
+	pool.wakeFiller()
+	return e, true
+}
+
+// takeIdle removes all idle items from the pool, it must be called with mu held
+func (pool *base[T]) takeIdle() []*entry[T] {
+	entries := pool.idle
+	pool.idle = nil
+	pool.current -= uint(len(entries))
+	return entries
+}
+
+// takeExcess removes the oldest idle items above idle limit, it must be
+// called with mu held
+func (pool *base[T]) takeExcess() []*entry[T] {
+	if uint(len(pool.idle)) <= pool.maxIdle {
+		return nil
+	}
+	n := uint(len(pool.idle)) - pool.maxIdle
+	entries := make([]*entry[T], n)
+	copy(entries, pool.idle)
+	for i := range pool.idle[:n] {
+		pool.idle[i] = nil
+	}
+	pool.idle = pool.idle[n:]
+	pool.current -= n
+	pool.notify()
+	return entries
+}
+
+// dropIdle releases the oldest idle item to free capacity for other pool,
+// reports false if there is no idle item
+func (pool *base[T]) dropIdle() bool {
+	pool.mu.Lock()
+	if len(pool.idle) == 0 {
+		pool.mu.Unlock()
+		return false
+	}
+	e := pool.idle[0]
+	pool.idle[0] = nil
+	pool.idle = pool.idle[1:]
+	pool.current--
+	pool.notify()
+	pool.mu.Unlock()
+
+	pool.drop(DestroyEvicted, e)
+	return true
+}
+
+// takeExpired removes idle items which are expired, it must be called with mu held
+func (pool *base[T]) takeExpired() []removal[T] {
+	now := pool.now()
+	var removed []removal[T]
+	idle := pool.idle[:0]
+	for _, e := range pool.idle {
+		if reason, ok := pool.expired(e, now); ok {
+			removed = append(removed, removal[T]{e: e, reason: reason})
+			continue
+		}
+		idle = append(idle, e)
+	}
+	for i := len(idle); i < len(pool.idle); i++ {
+		pool.idle[i] = nil
+	}
+	pool.idle = idle
+	if len(removed) > 0 {
+		pool.current -= uint(len(removed))
+		pool.notify()
+	}
+	return removed
+}
+
+// expired reports if idle item must be released and why
+func (pool *base[T]) expired(e *entry[T], now time.Time) (DestroyReason, bool) {
+	if pool.maxIdleTime > 0 && now.Sub(e.since) >= pool.maxIdleTime {
+		return DestroyIdleTimeout, true
+	}
+	return pool.outlived(e, now)
+}
+
+// outlived reports if item is too old or used too many times
+func (pool *base[T]) outlived(e *entry[T], now time.Time) (DestroyReason, bool) {
+	if pool.maxUses > 0 && e.uses >= pool.maxUses {
+		return DestroyMaxUses, true
+	}
+	if pool.maxLifetime > 0 {
+		lifetime := pool.maxLifetime - time.Duration(float64(pool.maxLifetime)*e.jitter)
+		if now.Sub(e.created) >= lifetime {
+			return DestroyLifetime, true
+		}
+	}
+	return 0, false
+}
+
+// track marks item as borrowed, it must be called with mu held
+func (pool *base[T]) track(e *entry[T]) {
+	e.uses++
+	e.lent = true
+	key, ok := itemKey(e.value)
+	if !ok || !pool.tracks(key) {
+		return
+	}
+	if pool.borrowed == nil {
+		pool.borrowed = make(map[any][]*entry[T])
+	}
+	pool.borrowed[key] = append(pool.borrowed[key], e)
+	pool.watch(e)
+	pool.hold(e)
+}
+
+// untrack finds borrowed item metadata, returns nil if item is unknown,
+// it must be called with mu held
+func (pool *base[T]) untrack(item T) *entry[T] {
+	key, ok := itemKey(item)
+	if !ok {
+		return nil
+	}
+	entries := pool.borrowed[key]
+	if len(entries) == 0 {
+		return nil
+	}
+	e := entries[len(entries)-1]
+	if len(entries) == 1 {
+		delete(pool.borrowed, key)
+	} else {
+		entries[len(entries)-1] = nil
+		pool.borrowed[key] = entries[:len(entries)-1]
+	}
+	e.lent = false
+	pool.unwatch(e)
+	pool.unhold(e)
+	return e
+}
+
+// untrackEntry forgets exactly this borrowed item, reports false if item was
+// already returned, it must be called with mu held
+func (pool *base[T]) untrackEntry(e *entry[T]) bool {
+	if !e.lent {
+		return false
+	}
+	e.lent = false
+	pool.unwatch(e)
+	pool.unhold(e)
+	pool.unborrow(e)
+	return true
+}
+
+// unborrow removes exactly this item from borrowed items, it must be called
+// with mu held
+func (pool *base[T]) unborrow(e *entry[T]) {
+	key, ok := itemKey(e.value)
+	if !ok {
+		return
+	}
+	entries := pool.borrowed[key]
+	for i, v := range entries {
+		if v != e {
+			continue
+		}
+		if len(entries) == 1 {
+			delete(pool.borrowed, key)
+			return
+		}
+		copy(entries[i:], entries[i+1:])
+		entries[len(entries)-1] = nil
+		pool.borrowed[key] = entries[:len(entries)-1]
+		return
+	}
+}
+
+// tracks reports if borrowed item is tracked, so it is found when it is
+// returned with Put. Pointers are always tracked to tell foreign item from
+// borrowed one, values only if their metadata is used. It must be called with
+// mu held.
+func (pool *base[T]) tracks(key any) bool {
+	return isPointer(key) || pool.strict || pool.detect || pool.abandonAfter > 0 ||
+		pool.maxLifetime > 0 || pool.maxUses > 0 || pool.loadHooks() != nil
+}
+
+// itemKey returns map key for item, reports false if item is not comparable
+// or it holds interface with value which is not comparable
+func itemKey[T any](item T) (any, bool) {
+	key := any(item)
+	t := reflect.TypeOf(key)
+	if t == nil {
+		return key, true
+	}
+	if !t.Comparable() {
+		return nil, false
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Array:
+		if holdsInterface(t) && !hashable(key) {
+			return nil, false
+		}
+	}
+	return key, true
+}
+
+// interfaceTypes caches results of holdsInterface
+var interfaceTypes sync.Map // reflect.Type -> bool
+
+// holdsInterface reports if value of type t may hold interface, such value
+// may be not comparable even if its type is
+func holdsInterface(t reflect.Type) bool {
+	if v, ok := interfaceTypes.Load(t); ok {
+		return v.(bool)
+	}
+	var holds bool
+	switch t.Kind() {
+	case reflect.Interface:
+		holds = true
+	case reflect.Array:
+		holds = holdsInterface(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField() && !holds; i++ {
+			holds = holdsInterface(t.Field(i).Type)
+		}
+	}
+	interfaceTypes.Store(t, holds)
+	return holds
+}
+
+// hashable reports if key can be used as map key, comparison of key panics
+// exactly if hashing does
+func hashable(key any) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	_ = equal(key, key)
+	return true
+}
+
+func equal(a, b any) bool {
+	return a == b
+}
+
+// comparableItems reports if items of type T can be matched on Put
+func comparableItems[T any]() bool {
+	return reflect.TypeOf((*T)(nil)).Elem().Comparable()
+}
+
+// room reports if one more live item fits into the limit, it must be called
+// with mu held
+func (pool *base[T]) room() bool {
+	return pool.max == 0 || pool.current < pool.max
+}
+
+// reserve takes idle item or reserves slot for new item, which is reported
+// as nil entry. Nothing is reserved while there are waiters, so they are not
+// overtaken. It must be called with mu held.
+func (pool *base[T]) reserve() (*entry[T], bool) {
+	if len(pool.waiters) > 0 {
+		return nil, false
+	}
+	if e, ok := pool.popIdle(); ok {
+		pool.inuse++
+		return e, true
+	}
+	if pool.room() {
+		pool.current++
+		pool.inuse++
+		return nil, true
+	}
+	return nil, false
+}
+
+// enqueue adds waiter which receives reserved item or slot, the channel is
+// closed if pool is closed, it must be called with mu held
+func (pool *base[T]) enqueue(p Priority) chan *entry[T] {
+	w := &waiter[T]{
+		ready:    make(chan *entry[T], 1),
+		priority: p,
+		since:    pool.now(),
+	}
+	pool.waiters = append(pool.waiters, w)
+	return w.ready
+}
+
+// dequeue removes waiter, reports false if waiter has already got item or
+// slot, it must be called with mu held
+func (pool *base[T]) dequeue(ready chan *entry[T]) bool {
+	for i, w := range pool.waiters {
+		if w.ready == ready {
+			pool.removeWaiter(i)
+			return true
+		}
+	}
+	return false
+}
+
+// removeWaiter removes i-th waiter keeping arrival order, it must be called
+// with mu held
+func (pool *base[T]) removeWaiter(i int) {
+	copy(pool.waiters[i:], pool.waiters[i+1:])
+	pool.waiters[len(pool.waiters)-1] = nil
+	pool.waiters = pool.waiters[:len(pool.waiters)-1]
+}
+
+// nextWaiter returns index of waiter with the highest aged priority, the
+// earliest one among equals, it must be called with mu held
+func (pool *base[T]) nextWaiter() int {
+	now := pool.now()
+	next, rank := 0, pool.waiters[0].rank(now, pool.aging)
+	for i, w := range pool.waiters[1:] {
+		if r := w.rank(now, pool.aging); r > rank {
+			next, rank = i+1, r
+		}
+	}
+	return next
+}
+
+// abandon removes waiter which gave up, item or slot which was already
+// reserved for it is returned, it must be called with mu held
+func (pool *base[T]) abandon(ready chan *entry[T]) {
+	if pool.dequeue(ready) {
+		return
+	}
+	if e, ok := <-ready; ok {
+		pool.revoke(e)
+	}
+}
+
+// revoke returns item or slot reserved for waiter which gave up, it must be
+// called with mu held
+func (pool *base[T]) revoke(e *entry[T]) {
+	pool.giveback()
+	if e == nil {
+		pool.current--
+	} else {
+		pool.pushIdle(e)
+	}
+	pool.notify()
+}
+
+// notify hands idle items and free slots to waiters by priority and arrival
+// order and wakes up background refill, it must be called with mu held
+func (pool *base[T]) notify() {
+	if pool.closed {
+		for _, w := range pool.waiters {
+			close(w.ready)
+		}
+		pool.waiters = nil
+	}
+	for len(pool.waiters) > 0 {
+		i := pool.nextWaiter()
+		w := pool.waiters[i]
+		if e, ok := pool.popIdle(); ok {
+			pool.inuse++
+			pool.shed.observe(pool.now().Sub(w.since))
+			w.ready <- e
+		} else if pool.room() {
+			pool.current++
+			pool.inuse++
+			pool.shed.observe(pool.now().Sub(w.since))
+			w.ready <- nil
+		} else {
+			break
+		}
+		pool.removeWaiter(i)
+	}
+	pool.wakeFiller()
+}
+
+// giveback marks borrowed item as returned, reports false if there was no
+// borrowed item (item is foreign), it must be called with mu held
+func (pool *base[T]) giveback() bool {
+	if pool.inuse == 0 {
+		return false
+	}
+	pool.inuse--
+	if pool.closed && pool.inuse == 0 && pool.drained != nil {
+		close(pool.drained)
+		pool.drained = nil
+	}
+	return true
+}
+
+// markClosed closes the pool and returns channel to wait for borrowed items,
+// reports false if pool is already closed, it must be called with mu held
+func (pool *base[T]) markClosed() (chan struct{}, bool) {
+	if pool.closed {
+		return nil, false
+	}
+	pool.closed = true
+	pool.notify()
+	pool.wakeCleaner()
+	if pool.fillerStop != nil {
+		pool.fillerStop()
+	}
+	if pool.inuse > 0 {
+		pool.drained = make(chan struct{})
+	}
+	return pool.drained, true
+}
+
+// waitDrained waits for borrowed items to be returned until ctx is done
+func (pool *base[T]) waitDrained(ctx context.Context, drained chan struct{}) error {
+	if drained == nil {
+		return nil
+	}
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return &WaitError{Err: ctx.Err()}
+	}
+}
+
+// Stats returns pool statistics
+func (pool *base[T]) Stats() Stats {
+	pool.mu.Lock()
+	stats := Stats{
+		MaxOpen: int(pool.max),
+		MaxIdle: int(pool.maxIdle),
+		Open:    int(pool.current),
+		InUse:   int(pool.inuse),
+		Idle:    len(pool.idle),
+	}
+	pool.mu.Unlock()
+
+	pool.stats.fill(&stats)
+	return stats
+}
+
+func (pool *base[T]) isClosed() bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.closed
+}
+
+// SetMaxIdle sets how many idle items are kept, it may not exceed the limit
+// of live items, items above the limit are released
+func (pool *base[T]) SetMaxIdle(n uint) {
+	pool.mu.Lock()
+	if pool.max > 0 && n > pool.max {
+		n = pool.max
+	}
+	pool.maxIdle = n
+	excess := pool.takeExcess()
+	pool.mu.Unlock()
+
+	pool.drop(DestroyIdleFull, excess...)
+}
+
+// SetIdleStrategy selects which idle item is handed out, unknown strategy
+// is ignored
+func (pool *base[T]) SetIdleStrategy(s IdleStrategy) {
+	if !s.valid() {
+		return
+	}
+	pool.mu.Lock()
+	pool.strategy = s
+	pool.mu.Unlock()
+}
+
+// SetMaxIdleTime sets how long item may stay idle before it is released,
+// zero disables the limit. Items are released on Get and by background
+// cleaner.
+func (pool *base[T]) SetMaxIdleTime(d time.Duration) {
+	pool.mu.Lock()
+	pool.maxIdleTime = d
+	expired := pool.takeExpired()
+	pool.startCleaner()
+	pool.mu.Unlock()
+
+	pool.dropAll(expired)
+}
+
+// SetMaxLifetime sets how long item may be reused since it was created,
+// zero disables the limit. Every item gets up to 10% shorter lifetime, so
+// items created together are not released together. Items are released on
+// Get, Put and by background cleaner. Values borrowed before the limit is
+// set are timed since they are returned. Items which are not comparable
+// cannot be matched on Put, so the call is ignored for them.
+func (pool *base[T]) SetMaxLifetime(d time.Duration) {
+	if !comparableItems[T]() {
+		return
+	}
+	pool.mu.Lock()
+	pool.maxLifetime = d
+	expired := pool.takeExpired()
+	pool.startCleaner()
+	pool.mu.Unlock()
+
+	pool.dropAll(expired)
+}
+
+// SetMaxUses sets how many times item may be handed out before it is
+// released, zero disables the limit. Uses of values borrowed before the
+// limit is set are counted since they are returned. Items which are not
+// comparable cannot be matched on Put, so the call is ignored for them.
+func (pool *base[T]) SetMaxUses(n uint) {
+	if !comparableItems[T]() {
+		return
+	}
+	pool.mu.Lock()
+	pool.maxUses = n
+	expired := pool.takeExpired()
+	pool.mu.Unlock()
+
+	pool.dropAll(expired)
+}
+
+// cleanInterval returns how often cleaner should run, zero if it is not
+// needed, it must be called with mu held
+func (pool *base[T]) cleanInterval() time.Duration {
+	d := pool.maxIdleTime
+	for _, v := range []time.Duration{pool.maxLifetime, pool.leakThreshold, pool.abandonAfter, pool.validateEvery} {
+		if v > 0 && (d <= 0 || v < d) {
+			d = v
+		}
+	}
+	if d <= 0 {
+		return 0
+	}
+	if d < minCleanInterval {
+		return minCleanInterval
+	}
+	return d
+}
+
+// startCleaner runs background cleaner if it is needed and not running yet,
+// it must be called with mu held
+func (pool *base[T]) startCleaner() {
+	if pool.closed || pool.cleanInterval() == 0 {
+		return
+	}
+	if pool.cleaner != nil {
+		pool.wakeCleaner()
+		return
+	}
+	pool.cleaner = make(chan struct{}, 1)
+	go clean(makeRef(pool), pool.cleaner, pool.cleanInterval())
+}
+
+// wakeCleaner makes cleaner recheck the pool, it must be called with mu held
+func (pool *base[T]) wakeCleaner() {
+	select {
+	case pool.cleaner <- struct{}{}:
+	default:
+	}
+}
+
+// clean periodically releases expired idle items until pool is closed,
+// garbage collected or limits are disabled
+func clean[T any](ref poolRef[T], wake chan struct{}, interval time.Duration) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+
+		pool := ref.get()
+		if pool == nil {
+			return
+		}
+		if interval = pool.cleanOnce(); interval == 0 {
+			return
+		}
+		timer.Reset(interval)
+	}
+}
+
+// cleanOnce releases expired idle items and returns when to run again, zero
+// if cleaner must exit
+func (pool *base[T]) cleanOnce() time.Duration {
+	pool.mu.Lock()
+	interval := pool.cleanInterval()
+	if pool.closed || interval == 0 {
+		pool.cleaner = nil
+		pool.mu.Unlock()
+		return 0
+	}
+	expired := pool.takeExpired()
+	expired = append(expired, pool.takeAbandoned()...)
+	leaks := pool.takeLeaks()
+	due := pool.takeUnchecked(pool.now())
+	pool.mu.Unlock()
+
+	pool.dropAll(expired)
+	pool.leaked(leaks...)
+	if len(due) > 0 {
+		pool.validateIdle(due)
+	}
+	return interval
+}
+
+// SetMinIdle sets how many idle items are kept ready by background refill
+// within the limits, zero stops the refill
+func (pool *base[T]) SetMinIdle(n uint) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.minIdle = n
+	if pool.closed || n == 0 || pool.filler != nil {
+		pool.wakeFiller()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.filler = make(chan struct{}, 1)
+	pool.fillerStop = cancel
+	pool.fillerDone = make(chan struct{})
+	go refill(ctx, makeRef(pool), pool.filler, pool.fillerDone)
+}
+
+// wakeFiller makes background refill recheck the pool, it must be called
+// with mu held
+func (pool *base[T]) wakeFiller() {
+	select {
+	case pool.filler <- struct{}{}:
+	default:
+	}
+}
+
+// waitFiller waits for background refill to exit after pool is closed or
+// until ctx is done, refill releases item created after close by itself
+func (pool *base[T]) waitFiller(ctx context.Context) error {
+	pool.mu.Lock()
+	done := pool.fillerDone
+	pool.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return &WaitError{Err: ctx.Err()}
+	}
+}
+
+// filling is state of background refill
+type filling struct {
+	backoff time.Duration // delay after the last factory failure
+	retry   time.Time     // when factory may be called again
+}
+
+// refill creates idle items until there are minIdle of them, it runs until
+// pool is closed, garbage collected or minIdle is set to zero
+func refill[T any](ctx context.Context, ref poolRef[T], wake, done chan struct{}) {
+	defer close(done)
+	var f filling
+	for {
+		pool := ref.get()
+		if pool == nil {
+			return
+		}
+		delay, ok := pool.fillOnce(ctx, &f)
+		if !ok {
+			return
+		}
+		if delay < 0 {
+			<-wake
+		} else if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-wake:
+				timer.Stop()
+			}
+		}
+	}
+}
+
+// fillOnce creates one idle item if it is needed and returns how long to
+// wait before the next one, negative delay means to wait for wake up. It
+// reports false if refill must exit.
+func (pool *base[T]) fillOnce(ctx context.Context, f *filling) (time.Duration, bool) {
+	pool.mu.Lock()
+	if pool.closed || pool.minIdle == 0 {
+		pool.fillerStop()
+		pool.filler, pool.fillerStop, pool.fillerDone = nil, nil, nil
+		pool.mu.Unlock()
+		return 0, false
+	}
+	idle := uint(len(pool.idle))
+	if idle >= pool.minIdle || idle >= pool.maxIdle || !pool.room() {
+		pool.mu.Unlock()
+		return -1, true
+	}
+	if delay := time.Until(f.retry); delay > 0 {
+		pool.mu.Unlock()
+		return delay, true
+	}
+	pool.current++
+	pool.mu.Unlock()
+
+	e, err := pool.spawn(ctx)
+	if err == nil && !pool.valid(e) {
+		pool.drop(DestroyCheckFailed, e)
+		e = nil
+	}
+
+	pool.mu.Lock()
+	if e == nil {
+		// the slot is freed, retry after backoff
+		pool.current--
+		pool.notify()
+		pool.mu.Unlock()
+		if f.backoff *= 2; f.backoff < minFillBackoff {
+			f.backoff = minFillBackoff
+		} else if f.backoff > maxFillBackoff {
+			f.backoff = maxFillBackoff
+		}
+		f.retry = time.Now().Add(f.backoff)
+		return 0, true
+	}
+	f.backoff = 0
+	if pool.closed {
+		pool.current--
+		pool.mu.Unlock()
+		pool.drop(DestroyClosed, e)
+		return 0, true
+	}
+	pool.pushIdle(e)
+	pool.notify()
+	pool.mu.Unlock()
+	return 0, true
+}
+
+// SetHooks sets lifecycle hooks, it replaces previously set hooks
+func (pool *base[T]) SetHooks(hooks Hooks[T]) {
+	pool.hooks.Store(&hooks)
+}
+
+// loadHooks returns current hooks, nil if hooks were never set
+func (pool *base[T]) loadHooks() *Hooks[T] {
+	hooks, _ := pool.hooks.Load().(*Hooks[T])
+	return hooks
+}
+
+// spawn creates new item with factory
+func (pool *base[T]) spawn(ctx context.Context) (*entry[T], error) {
+	item, err := pool.new(ctx)
+	if err != nil {
+		if pe, ok := err.(*passError); ok {
+			return nil, pe.err
+		}
+		return nil, &FactoryError{Err: err}
+	}
+	atomic.AddInt64(&pool.stats.created, 1)
+	e := pool.newEntry(item)
+	if hooks := pool.loadHooks(); hooks != nil && hooks.OnCreate != nil {
+		hooks.OnCreate(item, e.info(e.created))
+	}
+	return e, nil
+}
+
+// valid validates item with check callback
+func (pool *base[T]) valid(e *entry[T]) bool {
+	if pool.check == nil || pool.check(e.value) {
+		return true
+	}
+	atomic.AddInt64(&pool.stats.checkFailures, 1)
+	if hooks := pool.loadHooks(); hooks != nil && hooks.OnCheckFail != nil {
+		hooks.OnCheckFail(e.value, e.info(pool.now()))
+	}
+	return false
+}
+
+// lend reports item handed out to the caller
+func (pool *base[T]) lend(e *entry[T], wait time.Duration) {
+	if hooks := pool.loadHooks(); hooks != nil && hooks.OnBorrow != nil {
+		info := e.info(pool.now())
+		info.Wait = wait
+		hooks.OnBorrow(e.value, info)
+	}
+}
+
+// receive finds metadata of returned item and reports if item was borrowed.
+// Pointer which is not borrowed is foreign and pointer which is already idle
+// is rejected with ErrDoublePut. Equal values are interchangeable, so value
+// which is not borrowed returns borrowed slot, in strict mode it is rejected
+// with ErrDoublePut or ErrForeignPut. It must be called with mu held.
+func (pool *base[T]) receive(item T) (*entry[T], bool, error) {
+	if e := pool.untrack(item); e != nil {
+		return e, true, nil
+	}
+	if pool.wasReclaimed(item) {
+		return &entry[T]{value: item, abandoned: true}, false, nil
+	}
+	key, ok := itemKey(item)
+	if ok && (pool.strict || isPointer(key)) {
+		if pool.isIdle(key) {
+			return nil, false, ErrDoublePut
+		}
+		if pool.strict {
+			return nil, false, ErrForeignPut
+		}
+		return pool.newEntry(item), false, nil
+	}
+	return pool.newEntry(item), pool.inuse > 0, nil
+}
+
+// isPointer reports if item is identified by address
+func isPointer(item any) bool {
+	t := reflect.TypeOf(item)
+	if t == nil {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return true
+	}
+	return false
+}
+
+// receiveEntry forgets returned leased item, reports false if item was
+// already returned. Such item is ignored, in strict mode it is reported as
+// misuse. It must be called with mu held and it releases mu on false.
+func (pool *base[T]) receiveEntry(e *entry[T]) bool {
+	if pool.untrackEntry(e) {
+		return true
+	}
+	pool.mu.Unlock()
+	pool.misuse(e.value, ErrDoublePut)
+	return false
+}
+
+// isIdle reports if item with the key is idle, it must be called with mu held
+func (pool *base[T]) isIdle(key any) bool {
+	for _, e := range pool.idle {
+		if k, _ := itemKey(e.value); k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// misuse reports rejected item in strict mode, it panics in debug build.
+// Rejected item is ignored silently otherwise.
+func (pool *base[T]) misuse(item T, err error) {
+	if !pool.strict {
+		return
+	}
+	if hooks := pool.loadHooks(); hooks != nil && hooks.OnMisuse != nil {
+		hooks.OnMisuse(item, err)
+	}
+	if debugBuild {
+		panic("mpool: " + err.Error())
+	}
+}
+
+// returned reports item return, it must be called with mu held and it may
+// release mu to run the hook
+func (pool *base[T]) returned(e *entry[T]) {
+	if hooks := pool.loadHooks(); hooks != nil && hooks.OnReturn != nil {
+		pool.mu.Unlock()
+		hooks.OnReturn(e.value, e.info(pool.now()))
+		pool.mu.Lock()
+	}
+}
+
+// drop releases items with release callback
+func (pool *base[T]) drop(reason DestroyReason, entries ...*entry[T]) {
+	pool.stats.destroyed(reason, len(entries))
+	hooks := pool.loadHooks()
+	now := pool.now()
+	for _, e := range entries {
+		if hooks != nil && hooks.OnDestroy != nil {
+			hooks.OnDestroy(e.value, e.info(now), reason)
+		}
+		if pool.release != nil {
+			pool.release(e.value)
+		}
+	}
+}
+
+// dropAll releases removed items
+func (pool *base[T]) dropAll(removed []removal[T]) {
+	for _, r := range removed {
+		pool.drop(r.reason, r.e)
+	}
+}
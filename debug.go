@@ -0,0 +1,6 @@
+//go:build mpooldebug
+
+package mpool
+
+// debugBuild makes strict mode panic on misuse
+const debugBuild = true
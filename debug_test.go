@@ -0,0 +1,25 @@
+//go:build mpooldebug
+
+package mpool
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDebugBuild_StrictPanics(t *testing.T) {
+	pool, err := New(func(context.Context) (*MyType, error) {
+		return &MyType{}, nil
+	}, WithStrict())
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic on foreign Put")
+		}
+	}()
+	pool.Put(&MyType{})
+}
@@ -8,15 +8,20 @@ TODO: add more info
 
 Example:
 	...
-	pool, err := NewPool(2, 5, func() *object {
+	pool, err := New(func(ctx context.Context) (*object, error) {
 		fmt.Println("Shared object allocated")
-		return &object{}
-	}, func(i *object) {
-		fmt.Println("Shared released")
-	}, func(i *object) bool {
-		fmt.Println("Validate shared object")
-		return true
-	})
+		return &object{}, nil
+	},
+		WithMaxOpen(5),
+		WithMinIdle(2),
+		WithRelease(func(i *object) {
+			fmt.Println("Shared released")
+		}),
+		WithCheck(func(i *object) bool {
+			fmt.Println("Validate shared object")
+			return true
+		}),
+	)
 
 	if err!=nil {
 		panic("Error during pool creating:"+err)
@@ -0,0 +1,72 @@
+package mpool
+
+import "time"
+
+// Hooks are called on item lifecycle transitions, any hook can be nil.
+// Hooks are called without pool lock held, so they may use the pool.
+type Hooks[T any] struct {
+	// OnCreate is called when new item is created by factory
+	OnCreate func(item T, info ItemInfo)
+	// OnBorrow is called when item is handed out by Get
+	OnBorrow func(item T, info ItemInfo)
+	// OnReturn is called when item is returned by Put, before it becomes
+	// available to other callers, so it is the place to reset item state
+	OnReturn func(item T, info ItemInfo)
+	// OnDestroy is called before item is released with release callback
+	OnDestroy func(item T, info ItemInfo, reason DestroyReason)
+	// OnCheckFail is called when item fails check callback
+	OnCheckFail func(item T, info ItemInfo)
+	// OnMisuse is called when item is rejected in strict mode, err is
+	// ErrDoublePut or ErrForeignPut
+	OnMisuse func(item T, err error)
+	// OnLeak is called by leak detector when item is held longer than
+	// threshold or when its lease becomes unreachable without Release
+	OnLeak func(item T, info BorrowInfo)
+}
+
+// ItemInfo describes pooled item
+type ItemInfo struct {
+	Created time.Time     // When item was created
+	Age     time.Duration // How long ago item was created
+	Uses    uint          // How many times item was handed out
+	Wait    time.Duration // How long Get waited for the item, OnBorrow only
+}
+
+// DestroyReason tells why item is released
+type DestroyReason int
+
+const (
+	DestroyClosed      DestroyReason = iota // Pool is closed
+	DestroyDiscarded                        // Item is discarded by caller
+	DestroyCheckFailed                      // Item failed check callback
+	DestroyIdleFull                         // Pool has no room for idle item
+	DestroyIdleTimeout                      // Item was idle longer than SetMaxIdleTime
+	DestroyLifetime                         // Item is older than SetMaxLifetime
+	DestroyMaxUses                          // Item was used SetMaxUses times
+	DestroyEvicted                          // Item is evicted to make room for item of other key
+	DestroyAbandoned                        // Item was borrowed longer than WithRemoveAbandoned
+)
+
+func (r DestroyReason) String() string {
+	switch r {
+	case DestroyClosed:
+		return "closed"
+	case DestroyDiscarded:
+		return "discarded"
+	case DestroyCheckFailed:
+		return "check failed"
+	case DestroyIdleFull:
+		return "idle full"
+	case DestroyIdleTimeout:
+		return "idle timeout"
+	case DestroyLifetime:
+		return "lifetime"
+	case DestroyMaxUses:
+		return "max uses"
+	case DestroyEvicted:
+		return "evicted"
+	case DestroyAbandoned:
+		return "abandoned"
+	}
+	return "unknown"
+}
@@ -0,0 +1,343 @@
+package mpool
+
+import (
+	"context"
+	"sync"
+)
+
+// KeyedFactory creates new item for the key, ctx is the one passed to GetContext
+type KeyedFactory[K comparable, T any] func(ctx context.Context, key K) (T, error)
+
+// KeyedPool keeps separate pool for every key, e.g. for every backend address
+type KeyedPool[K comparable, T any] interface {
+	// Get returns item for the key, waits for released item if needed
+	Get(key K) (T, bool)
+	// GetContext returns item for the key, waits for released item until ctx is done
+	GetContext(ctx context.Context, key K) (T, error)
+	// Put returns borrowed item to the pool of the key
+	Put(key K, item T)
+	// Discard releases borrowed item instead of returning it to the pool
+	Discard(key K, item T)
+	// Close stops all pools and releases items, waits for borrowed items until ctx is done
+	Close(ctx context.Context) error
+	// Stats returns statistics of the pool of the key, reports false if there is no such pool
+	Stats(key K) (Stats, bool)
+	// Keys returns keys which have pools
+	Keys() []K
+}
+
+// subPool is pool of one key
+type subPool[T any] struct {
+	pool Pool[T]
+	refs uint // Get calls in progress and borrowed items
+}
+
+// keyedPool provides generic keyed pool, pools of keys are created on demand
+// and removed when they have no items
+type keyedPool[K comparable, T any] struct {
+	new     KeyedFactory[K, T]
+	release func(T)
+	opts    []Option
+	mu      sync.Mutex
+	pools   map[K]*subPool[T]
+	empty   map[K]struct{} // keys which pools may have no items
+	total   uint           // live items of all keys
+	max     uint           // limit of live items of all keys, zero for no limit
+	wake    chan struct{}  // closed and replaced when item of any key is released or returned
+	closed  bool
+}
+
+// NewKeyed creates keyed pool, options are applied to the pool of every key,
+// e.g. WithMaxOpen limits items of one key, and WithMaxTotal limits items of
+// all keys
+func NewKeyed[K comparable, T any](factory KeyedFactory[K, T], opts ...Option) (KeyedPool[K, T], error) {
+	if factory == nil {
+		return nil, &OptionError{Option: "factory", Reason: "must not be nil"}
+	}
+	c := &config{keyed: true}
+	for _, opt := range opts {
+		if err := opt.apply(c); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	kp := &keyedPool[K, T]{
+		new:   factory,
+		opts:  append(opts[:len(opts):len(opts)], asKeyed()),
+		pools: make(map[K]*subPool[T]),
+		empty: make(map[K]struct{}),
+		max:   c.maxTotal,
+	}
+	if c.release != nil {
+		release, ok := c.release.(func(T))
+		if !ok {
+			return nil, &OptionError{Option: "WithRelease", Reason: "item type does not match pool"}
+		}
+		kp.release = release
+	}
+	return kp, nil
+}
+
+func (kp *keyedPool[K, T]) Get(key K) (T, bool) {
+	item, err := kp.GetContext(context.Background(), key)
+	return item, err == nil
+}
+
+func (kp *keyedPool[K, T]) GetContext(ctx context.Context, key K) (T, error) {
+	kp.sweep()
+	var zero T
+	pool, err := kp.acquire(ctx, key)
+	if err != nil {
+		return zero, err
+	}
+	item, err := pool.GetContext(ctx)
+	if err != nil {
+		kp.unref(key)
+		return zero, err
+	}
+	return item, nil
+}
+
+// acquire returns pool of the key and counts the caller, pool is created if
+// there is none
+func (kp *keyedPool[K, T]) acquire(ctx context.Context, key K) (Pool[T], error) {
+	kp.mu.Lock()
+	if kp.closed {
+		kp.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	if sub, ok := kp.pools[key]; ok {
+		sub.refs++
+		kp.mu.Unlock()
+		return sub.pool, nil
+	}
+	kp.mu.Unlock()
+
+	// factory may be called during initial fill, so pool is created without lock
+	opts := append(kp.opts[:len(kp.opts):len(kp.opts)], WithRelease(kp.releaser(key)))
+	pool, err := newPool(ctx, kp.factory(key), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	kp.mu.Lock()
+	sub, ok := kp.pools[key]
+	if !ok && !kp.closed {
+		sub = &subPool[T]{pool: pool}
+		kp.pools[key] = sub
+	}
+	closed := kp.closed
+	if sub != nil {
+		sub.refs++
+	}
+	kp.mu.Unlock()
+
+	if ok || closed {
+		// pool was created by concurrent call or keyed pool was closed
+		pool.Close(context.Background())
+	}
+	if closed {
+		return nil, ErrPoolClosed
+	}
+	return sub.pool, nil
+}
+
+// factory makes factory of the key which counts items of all keys
+func (kp *keyedPool[K, T]) factory(key K) Factory[T] {
+	return func(ctx context.Context) (T, error) {
+		if err := kp.reserve(ctx); err != nil {
+			var zero T
+			return zero, &passError{err: err}
+		}
+		item, err := kp.new(ctx, key)
+		if err != nil {
+			kp.free(key)
+		}
+		return item, err
+	}
+}
+
+// releaser makes release callback of the key which counts items of all keys
+func (kp *keyedPool[K, T]) releaser(key K) func(T) {
+	return func(item T) {
+		if kp.release != nil {
+			kp.release(item)
+		}
+		kp.free(key)
+	}
+}
+
+// reserve counts new item, waits until item of any key is released if limit
+// of all keys is reached, idle items of other keys are released to make room
+func (kp *keyedPool[K, T]) reserve(ctx context.Context) error {
+	for {
+		kp.mu.Lock()
+		if kp.closed {
+			kp.mu.Unlock()
+			return ErrPoolClosed
+		}
+		if kp.max == 0 || kp.total < kp.max {
+			kp.total++
+			kp.mu.Unlock()
+			return nil
+		}
+		pools := make([]Pool[T], 0, len(kp.pools))
+		for _, sub := range kp.pools {
+			pools = append(pools, sub.pool)
+		}
+		if kp.wake == nil {
+			kp.wake = make(chan struct{})
+		}
+		wake := kp.wake
+		kp.mu.Unlock()
+
+		if evict(pools) {
+			continue
+		}
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return &WaitError{Err: ctx.Err(), Exhausted: true}
+		}
+	}
+}
+
+// evict releases one idle item of any pool, reports false if there is none
+func evict[T any](pools []Pool[T]) bool {
+	for _, pool := range pools {
+		if p, ok := pool.(interface{ dropIdle() bool }); ok && p.dropIdle() {
+			return true
+		}
+	}
+	return false
+}
+
+// free uncounts released item of the key
+func (kp *keyedPool[K, T]) free(key K) {
+	kp.mu.Lock()
+	kp.total--
+	kp.empty[key] = struct{}{}
+	kp.notify()
+	kp.mu.Unlock()
+}
+
+// notify wakes up callers waiting for limit of all keys, it must be called
+// with mu held
+func (kp *keyedPool[K, T]) notify() {
+	if kp.wake != nil {
+		close(kp.wake)
+		kp.wake = nil
+	}
+}
+
+// unref uncounts the caller of the key
+func (kp *keyedPool[K, T]) unref(key K) {
+	kp.mu.Lock()
+	if sub, ok := kp.pools[key]; ok && sub.refs > 0 {
+		sub.refs--
+		if sub.refs == 0 {
+			kp.empty[key] = struct{}{}
+		}
+	}
+	kp.mu.Unlock()
+}
+
+// sweep removes pools which have no items and no callers
+func (kp *keyedPool[K, T]) sweep() {
+	kp.mu.Lock()
+	var removed []Pool[T]
+	for key := range kp.empty {
+		delete(kp.empty, key)
+		sub, ok := kp.pools[key]
+		if !ok || sub.refs > 0 || sub.pool.Stats().Open > 0 {
+			continue
+		}
+		delete(kp.pools, key)
+		removed = append(removed, sub.pool)
+	}
+	kp.mu.Unlock()
+
+	for _, pool := range removed {
+		pool.Close(context.Background())
+	}
+}
+
+// lookup returns pool of the key, nil if there is none
+func (kp *keyedPool[K, T]) lookup(key K) Pool[T] {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	if sub, ok := kp.pools[key]; ok {
+		return sub.pool
+	}
+	return nil
+}
+
+func (kp *keyedPool[K, T]) Put(key K, item T) {
+	if pool := kp.lookup(key); pool != nil {
+		pool.Put(item)
+		kp.unref(key)
+		kp.mu.Lock()
+		kp.notify()
+		kp.mu.Unlock()
+	} else if kp.release != nil {
+		kp.release(item)
+	}
+	kp.sweep()
+}
+
+func (kp *keyedPool[K, T]) Discard(key K, item T) {
+	if pool := kp.lookup(key); pool != nil {
+		pool.Discard(item)
+		kp.unref(key)
+	} else if kp.release != nil {
+		kp.release(item)
+	}
+	kp.sweep()
+}
+
+// Close stops pools of all keys: new Get calls fail with ErrPoolClosed,
+// borrowed items are released on Put. Close waits until all borrowed items
+// are returned or ctx is done, and then releases idle items.
+func (kp *keyedPool[K, T]) Close(ctx context.Context) error {
+	kp.mu.Lock()
+	if kp.closed {
+		kp.mu.Unlock()
+		return ErrPoolClosed
+	}
+	kp.closed = true
+	kp.notify()
+	pools := make([]Pool[T], 0, len(kp.pools))
+	for _, sub := range kp.pools {
+		pools = append(pools, sub.pool)
+	}
+	kp.mu.Unlock()
+
+	var result error
+	for _, pool := range pools {
+		if err := pool.Close(ctx); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+func (kp *keyedPool[K, T]) Stats(key K) (Stats, bool) {
+	pool := kp.lookup(key)
+	if pool == nil {
+		return Stats{}, false
+	}
+	return pool.Stats(), true
+}
+
+func (kp *keyedPool[K, T]) Keys() []K {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	keys := make([]K, 0, len(kp.pools))
+	for key := range kp.pools {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,167 @@
+package mpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBasicKeyedPool_API(t *testing.T) {
+	var created int32
+
+	pool, err := NewKeyed(func(ctx context.Context, key string) (string, error) {
+		atomic.AddInt32(&created, 1)
+		return key, nil
+	}, WithMaxOpen(1))
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	a, ok := pool.Get("a")
+	if !ok || a != "a" {
+		t.Error("Expected item of key a", a)
+		t.FailNow()
+	}
+
+	b, ok := pool.Get("b")
+	if !ok || b != "b" {
+		t.Error("Expected item of key b", b)
+		t.FailNow()
+	}
+
+	if keys := pool.Keys(); len(keys) != 2 {
+		t.Error("Expected pools of two keys", keys)
+		t.FailNow()
+	}
+
+	// limit is applied per key
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.GetContext(ctx, "a"); !errors.Is(err, ErrWaitTimeout) {
+		t.Error("Expected ErrWaitTimeout", err)
+		t.FailNow()
+	}
+
+	if stats, ok := pool.Stats("a"); !ok || stats.InUse != 1 || stats.MaxOpen != 1 {
+		t.Error("Expected stats of key a", stats)
+		t.FailNow()
+	}
+
+	if _, ok := pool.Stats("c"); ok {
+		t.Error("Expected no stats of unknown key")
+		t.FailNow()
+	}
+
+	pool.Put("a", a)
+	if v, _ := pool.Get("a"); v != "a" || atomic.LoadInt32(&created) != 2 {
+		t.Error("Expected idle item to be reused", v, created)
+		t.FailNow()
+	} else {
+		pool.Put("a", v)
+	}
+
+	pool.Put("b", b)
+	if err := pool.Close(context.Background()); err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	if _, err := pool.GetContext(context.Background(), "a"); err != ErrPoolClosed {
+		t.Error("Expected ErrPoolClosed", err)
+		t.FailNow()
+	}
+}
+
+func TestBasicKeyedPool_MaxTotal(t *testing.T) {
+	var released []string
+
+	pool, err := NewKeyed(func(ctx context.Context, key string) (string, error) {
+		return key, nil
+	},
+		WithMaxOpen(2),
+		WithMaxTotal(2),
+		WithRelease(func(v string) { released = append(released, v) }),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	a1, _ := pool.Get("a")
+	a2, _ := pool.Get("a")
+	pool.Put("a", a2)
+
+	// idle item of key a is released to make room for key b
+	b, ok := pool.Get("b")
+	if !ok || len(released) != 1 || released[0] != "a" {
+		t.Error("Expected idle item of other key to be evicted", b, released)
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = pool.GetContext(ctx, "c")
+	if !errors.Is(err, ErrPoolExhausted) || errors.Is(err, ErrFactoryFailed) {
+		t.Error("Expected ErrPoolExhausted", err)
+		t.FailNow()
+	}
+
+	done := make(chan string)
+	go func() {
+		v, _ := pool.Get("c")
+		done <- v
+	}()
+	time.Sleep(20 * time.Millisecond)
+	pool.Discard("a", a1)
+
+	if v := <-done; v != "c" {
+		t.Error("Expected waiter to get item after release", v)
+		t.FailNow()
+	}
+
+	pool.Put("b", b)
+	pool.Put("c", "c")
+	pool.Close(context.Background())
+}
+
+func TestBasicKeyedPool_EmptyPools(t *testing.T) {
+	errFactory := errors.New("factory failed")
+
+	pool, err := NewKeyed(func(ctx context.Context, key int) (int, error) {
+		if key < 0 {
+			return 0, errFactory
+		}
+		return key, nil
+	}, WithMaxIdle(0))
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	v, _ := pool.Get(1)
+	pool.Put(1, v)
+	if keys := pool.Keys(); len(keys) != 0 {
+		t.Error("Expected empty pool to be removed", keys)
+		t.FailNow()
+	}
+
+	if _, err := pool.GetContext(context.Background(), -1); !errors.Is(err, errFactory) {
+		t.Error("Expected factory error", err)
+		t.FailNow()
+	}
+	pool.Get(2)
+	if keys := pool.Keys(); len(keys) != 1 || keys[0] != 2 {
+		t.Error("Expected pool without items to be removed", keys)
+		t.FailNow()
+	}
+
+	_, err = New(func(context.Context) (int, error) { return 1, nil }, WithMaxTotal(1))
+	var optErr *OptionError
+	if !errors.As(err, &optErr) || optErr.Option != "WithMaxTotal" {
+		t.Error("Expected WithMaxTotal error", err)
+		t.FailNow()
+	}
+}
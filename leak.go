@@ -0,0 +1,183 @@
+package mpool
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maxStackDepth limits how many frames of borrower stack are recorded
+const maxStackDepth = 32
+
+// BorrowInfo describes outstanding borrow recorded by leak detector
+type BorrowInfo struct {
+	Acquired    time.Time     // When item was borrowed
+	Held        time.Duration // How long item is borrowed
+	Stack       string        // Stack trace of the borrower
+	Unreachable bool          // Lease became unreachable without Release, OnLeak only
+}
+
+// Borrow is outstanding borrowed item
+type Borrow[T any] struct {
+	Item T
+	BorrowInfo
+}
+
+// poolPackage prefixes names of functions of the pool package
+var poolPackage = reflect.TypeOf(borrow{}).PkgPath() + "."
+
+// borrow is record of borrowed item
+type borrow struct {
+	acquired time.Time
+	pcs      []uintptr
+	flagged  bool // item was reported as held longer than threshold
+}
+
+// info describes the borrow, stack is formatted on demand starting from the
+// borrower, frames of the pool are skipped
+func (b *borrow) info(now time.Time) BorrowInfo {
+	var stack strings.Builder
+	frames := runtime.CallersFrames(b.pcs)
+	borrower := false
+	for {
+		frame, more := frames.Next()
+		if !borrower && poolFrame(frame) {
+			if !more {
+				break
+			}
+			continue
+		}
+		borrower = true
+		stack.WriteString(frame.Function)
+		stack.WriteString("\n\t")
+		stack.WriteString(frame.File)
+		stack.WriteString(":")
+		stack.WriteString(strconv.Itoa(frame.Line))
+		stack.WriteString("\n")
+		if !more {
+			break
+		}
+	}
+	return BorrowInfo{
+		Acquired: b.acquired,
+		Held:     now.Sub(b.acquired),
+		Stack:    stack.String(),
+	}
+}
+
+// poolFrame reports if frame belongs to the pool, tests of the package are
+// borrowers
+func poolFrame(frame runtime.Frame) bool {
+	return strings.HasPrefix(frame.Function, poolPackage) && !strings.HasSuffix(frame.File, "_test.go")
+}
+
+// leak is item reported by leak detector
+type leak[T any] struct {
+	item T
+	info BorrowInfo
+}
+
+// watch records borrower of the item, it must be called with mu held
+func (pool *base[T]) watch(e *entry[T]) {
+	if !pool.detect {
+		return
+	}
+	if _, ok := pool.watched[e]; ok {
+		return
+	}
+	pcs := make([]uintptr, maxStackDepth)
+	// skip runtime.Callers and watch, other frames of the pool are skipped
+	// when stack is formatted
+	n := runtime.Callers(2, pcs)
+	if pool.watched == nil {
+		pool.watched = make(map[*entry[T]]*borrow)
+	}
+	pool.watched[e] = &borrow{acquired: pool.now(), pcs: pcs[:n]}
+}
+
+// unwatch forgets borrower of returned item, it must be called with mu held
+func (pool *base[T]) unwatch(e *entry[T]) {
+	delete(pool.watched, e)
+}
+
+// watchLease records borrower of leased item and reports lease which becomes
+// unreachable without Release, leased item is also checked for abandonment
+func (pool *base[T]) watchLease(l *Lease[T]) {
+	pool.mu.Lock()
+	detect := pool.detect
+	pool.watch(l.e)
+	pool.hold(l.e)
+	pool.mu.Unlock()
+	if !detect {
+		return
+	}
+	runtime.SetFinalizer(l, func(l *Lease[T]) {
+		if atomic.LoadInt32(&l.done) == 0 {
+			pool.lost(l.e)
+		}
+	})
+}
+
+// lost reports leased item which can never be returned
+func (pool *base[T]) lost(e *entry[T]) {
+	pool.mu.Lock()
+	b, ok := pool.watched[e]
+	if !ok {
+		pool.mu.Unlock()
+		return
+	}
+	b.flagged = true
+	info := b.info(pool.now())
+	pool.mu.Unlock()
+
+	info.Unreachable = true
+	pool.leaked(leak[T]{item: e.value, info: info})
+}
+
+// takeLeaks finds items held longer than threshold which were not reported
+// yet, it must be called with mu held
+func (pool *base[T]) takeLeaks() []leak[T] {
+	if pool.leakThreshold <= 0 {
+		return nil
+	}
+	now := pool.now()
+	var leaks []leak[T]
+	for e, b := range pool.watched {
+		if b.flagged || now.Sub(b.acquired) < pool.leakThreshold {
+			continue
+		}
+		b.flagged = true
+		leaks = append(leaks, leak[T]{item: e.value, info: b.info(now)})
+	}
+	return leaks
+}
+
+// leaked reports leaks with the hook
+func (pool *base[T]) leaked(leaks ...leak[T]) {
+	hooks := pool.loadHooks()
+	if hooks == nil || hooks.OnLeak == nil {
+		return
+	}
+	for _, l := range leaks {
+		hooks.OnLeak(l.item, l.info)
+	}
+}
+
+// Borrows returns outstanding borrows recorded by leak detector, nil if
+// detector is disabled
+func (pool *base[T]) Borrows() []Borrow[T] {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if !pool.detect {
+		return nil
+	}
+	now := pool.now()
+	borrows := make([]Borrow[T], 0, len(pool.watched))
+	for e, b := range pool.watched {
+		borrows = append(borrows, Borrow[T]{Item: e.value, BorrowInfo: b.info(now)})
+	}
+	return borrows
+}
@@ -0,0 +1,98 @@
+package mpool
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// leaser is pool which hands out leases
+type leaser[T any] interface {
+	putEntry(e *entry[T])
+	discardEntry(e *entry[T])
+	now() time.Time
+}
+
+// Lease is handle of borrowed item, it returns exactly the borrowed item to
+// the pool and only once, so item cannot be confused with foreign one or be
+// returned twice
+type Lease[T any] struct {
+	pool     leaser[T]
+	e        *entry[T]
+	info     ItemInfo // item metadata when lease was acquired
+	acquired time.Time
+	done     int32
+	mu       sync.Mutex
+	err      error
+}
+
+func newLease[T any](pool leaser[T], e *entry[T], wait time.Duration) *Lease[T] {
+	now := pool.now()
+	info := e.info(now)
+	info.Wait = wait
+	return &Lease[T]{
+		pool:     pool,
+		e:        e,
+		info:     info,
+		acquired: now,
+	}
+}
+
+// Value returns leased item
+func (l *Lease[T]) Value() T {
+	return l.e.value
+}
+
+// AcquiredAt returns when lease was acquired
+func (l *Lease[T]) AcquiredAt() time.Time {
+	return l.acquired
+}
+
+// Info returns item metadata, Uses includes this lease and Age is current
+func (l *Lease[T]) Info() ItemInfo {
+	info := l.info
+	info.Age = l.pool.now().Sub(info.Created)
+	return info
+}
+
+// MarkBroken records why item is broken, so Release discards it instead of
+// returning to the pool, nil err is ignored
+func (l *Lease[T]) MarkBroken(err error) {
+	if err == nil {
+		return
+	}
+	l.mu.Lock()
+	if l.err == nil {
+		l.err = err
+	}
+	l.mu.Unlock()
+}
+
+// Err returns error passed to MarkBroken, nil if item is not broken
+func (l *Lease[T]) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Release returns item to the pool or discards it if it is marked broken,
+// only the first Release or Discard call has effect
+func (l *Lease[T]) Release() {
+	if !atomic.CompareAndSwapInt32(&l.done, 0, 1) {
+		return
+	}
+	if l.Err() != nil {
+		l.pool.discardEntry(l.e)
+		return
+	}
+	l.pool.putEntry(l.e)
+}
+
+// Discard releases item instead of returning it to the pool, only the first
+// Release or Discard call has effect
+func (l *Lease[T]) Discard() {
+	if !atomic.CompareAndSwapInt32(&l.done, 0, 1) {
+		return
+	}
+	l.pool.discardEntry(l.e)
+}
@@ -0,0 +1,148 @@
+package mpool
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBasicLease_Release(t *testing.T) {
+	var released int
+
+	pool, err := NewLimitedPool(0, 1, func() *MyType { return &MyType{Value: 1} }, func(*MyType) {
+		released++
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*limitedPool[*MyType])
+
+	lease, err := pool.Acquire(context.Background())
+	if err != nil || lease.Value().Value != 1 {
+		t.Error("Expected lease without error", err)
+		t.FailNow()
+	}
+
+	if info := lease.Info(); info.Uses != 1 || info.Created.IsZero() || lease.AcquiredAt().IsZero() {
+		t.Error("Expected lease metadata", info)
+		t.FailNow()
+	}
+
+	lease.Release()
+	lease.Release()
+	lease.Discard()
+	if raw.current != 1 || raw.inuse != 0 || len(raw.idle) != 1 || released != 0 {
+		t.Error("Expected item to be returned once", raw.current, raw.inuse, len(raw.idle), released)
+		t.FailNow()
+	}
+
+	lease, _ = pool.Acquire(context.Background())
+	if info := lease.Info(); info.Uses != 2 {
+		t.Error("Expected item to be reused", info.Uses)
+		t.FailNow()
+	}
+
+	errBroken := errors.New("connection reset")
+	lease.MarkBroken(errBroken)
+	lease.MarkBroken(errors.New("other"))
+	if lease.Err() != errBroken {
+		t.Error("Expected the first error", lease.Err())
+		t.FailNow()
+	}
+
+	lease.Release()
+	if raw.current != 0 || raw.inuse != 0 || released != 1 {
+		t.Error("Expected broken item to be discarded", raw.current, raw.inuse, released)
+		t.FailNow()
+	}
+
+	pool.Close(context.Background())
+}
+
+func TestBasicLease_Discard(t *testing.T) {
+	var released []int
+
+	pool, err := NewPool(0, 2, func() int { return 1 }, func(v int) {
+		released = append(released, v)
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*unlimitedPool[int])
+
+	l1, _ := pool.Acquire(context.Background())
+	l2, _ := pool.Acquire(context.Background())
+
+	// equal values do not confuse leases
+	l1.Discard()
+	l1.Release()
+	l2.Release()
+	if raw.current != 1 || raw.inuse != 0 || len(raw.idle) != 1 || len(released) != 1 {
+		t.Error("Expected one item to be discarded and one returned", raw.current, raw.inuse, len(raw.idle), released)
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pool.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Error("Expected Canceled", err)
+		t.FailNow()
+	}
+
+	pool.Close(context.Background())
+	if _, err := pool.Acquire(context.Background()); err != ErrPoolClosed {
+		t.Error("Expected ErrPoolClosed", err)
+		t.FailNow()
+	}
+}
+
+func TestBasicLease_PutThenRelease(t *testing.T) {
+	var misused []error
+
+	pool, err := New(func(context.Context) (*MyType, error) {
+		return &MyType{Value: 1}, nil
+	},
+		WithMaxOpen(2),
+		WithStrict(),
+		WithHooks(Hooks[*MyType]{
+			OnMisuse: func(item *MyType, err error) { misused = append(misused, err) },
+		}),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+	if debugBuild {
+		t.Skip("Strict mode panics in debug build")
+	}
+
+	lease, _ := pool.Acquire(context.Background())
+	pool.Put(lease.Value())
+	lease.Release()
+	if len(misused) != 1 || misused[0] != ErrDoublePut {
+		t.Error("Expected double put to be reported", misused)
+		t.FailNow()
+	}
+	if stats := pool.Stats(); stats.Created != 1 || stats.Open != 1 || stats.Idle != 1 {
+		t.Error("Expected item to be idle once", stats)
+		t.FailNow()
+	}
+	pool.Close(context.Background())
+
+	unlimited, err := NewPool(0, 2, func() *MyType { return &MyType{Value: 1} }, nil, nil)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	lease, _ = unlimited.Acquire(context.Background())
+	unlimited.Put(lease.Value())
+	lease.Discard()
+	if stats := unlimited.Stats(); stats.Created != 1 || stats.Idle != 1 || stats.InUse != 0 || stats.Released != 0 {
+		t.Error("Expected returned lease to be ignored", stats)
+		t.FailNow()
+	}
+	unlimited.Close(context.Background())
+}
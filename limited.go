@@ -1,109 +1,394 @@
 package mpool
 
 import (
+	"context"
+	"log"
 	"runtime"
-	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Pool provides generic limited pool
 type limitedPool[T any] struct {
-	new     func() T
-	release func(T)
-	check   func(T) bool
-	queue   chan T
-	max     uint
-	current uint
-	mu      sync.Mutex
+	base[T]
 }
 
 func NewLimitedPool[T any](initial, max uint, new func() T, release func(T), check func(T) bool) (Pool[T], error) {
-	if max == 0 || initial > max || new == nil {
+	if new == nil {
 		return nil, ErrorInvalidParameters
 	}
+	return NewLimitedPoolWithFactory(context.Background(), initial, max, simpleFactory(new), release, check)
+}
 
-	pool := &limitedPool[T]{
-		queue:   make(chan T, max),
-		new:     new,
-		release: release,
-		check:   check,
-		max:     max,
-		current: initial,
+// NewLimitedPoolWithFactory creates limited pool with factory which can fail,
+// ctx is passed to factory during initial fill
+func NewLimitedPoolWithFactory[T any](ctx context.Context, initial, max uint, factory Factory[T], release func(T), check func(T) bool) (Pool[T], error) {
+	if max == 0 || initial > max || factory == nil {
+		return nil, ErrorInvalidParameters
 	}
+	return newPool(ctx, factory, append(positional(initial, release, check), WithMaxOpen(max))...)
+}
+
+// newLimitedPool creates pool with validated options
+func newLimitedPool[T any](ctx context.Context, factory Factory[T], c *config) (Pool[T], error) {
+	pool := &limitedPool[T]{}
+	if err := pool.configure(factory, c); err != nil {
+		return nil, err
+	}
+	if err := pool.fill(ctx, c.prefill()); err != nil {
+		pool.destroy(context.Background())
+		return nil, err
+	}
+	pool.SetMinIdle(c.minIdle)
 
 	runtime.SetFinalizer(pool, func(v *limitedPool[T]) {
-		v.destroy()
+		if !v.isClosed() {
+			log.Println("mpool: limited pool is garbage collected without Close")
+			v.destroy(context.Background())
+		}
 	})
 
-	for ; initial > 0; initial-- {
-		pool.queue <- pool.new()
+	return pool, nil
+}
+
+// SetMaxOpen sets the limit of live items, zero is ignored. Idle limit is
+// lowered to the new limit if needed, borrowed items above the limit are
+// released on Put.
+func (pool *limitedPool[T]) SetMaxOpen(n uint) {
+	if n == 0 {
+		return
 	}
+	pool.mu.Lock()
+	pool.max = n
+	if pool.maxIdle > n {
+		pool.maxIdle = n
+	}
+	excess := pool.takeExcess()
+	pool.notify()
+	pool.mu.Unlock()
 
-	return pool, nil
+	pool.drop(DestroyIdleFull, excess...)
 }
 
 func (pool *limitedPool[T]) Get() (T, bool) {
-	if pool.queue == nil {
-		// pool aleardy destroyed, return nothing
+	item, err := pool.GetContext(context.Background())
+	return item, err == nil
+}
+
+func (pool *limitedPool[T]) GetContext(ctx context.Context) (T, error) {
+	e, wait, err := pool.acquire(ctx, true)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	pool.lend(e, wait)
+	return e.value, nil
+}
+
+// Acquire returns lease of item from the pool, waits for released item until
+// ctx is done
+func (pool *limitedPool[T]) Acquire(ctx context.Context) (*Lease[T], error) {
+	e, wait, err := pool.acquire(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	pool.lend(e, wait)
+	l := newLease[T](pool, e, wait)
+	pool.watchLease(l)
+	return l, nil
+}
+
+// TryGet returns idle item or creates new one if limit is not reached,
+// it never waits for released item
+func (pool *limitedPool[T]) TryGet() (T, bool) {
+	e, _, err := pool.acquire(context.Background(), false)
+	if err != nil {
 		var zero T
 		return zero, false
 	}
+	pool.lend(e, 0)
+	return e.value, true
+}
+
+// acquire takes valid idle item or creates new one, waits by priority and
+// arrival order if limit is reached and block is set, otherwise fails with
+// ErrPoolExhausted
+func (pool *limitedPool[T]) acquire(ctx context.Context, block bool) (_ *entry[T], wait time.Duration, _ error) {
+	var (
+		attempts  int
+		waitStart time.Time
+		shedTimer *time.Timer
+	)
+	defer func() {
+		if shedTimer != nil {
+			shedTimer.Stop()
+		}
+		if !waitStart.IsZero() {
+			wait = pool.now().Sub(waitStart)
+			pool.stats.waited(wait)
+		}
+	}()
 
 	for {
-		select {
-		case item := <-pool.queue:
-			if pool.check != nil && pool.check(item) == false {
-				if pool.release != nil {
-					pool.release(item)
-				}
-				item = pool.new()
+		pool.mu.Lock()
+		if pool.closed {
+			pool.mu.Unlock()
+			return nil, wait, ErrPoolClosed
+		}
+
+		if err := ctx.Err(); err != nil {
+			pool.mu.Unlock()
+			return nil, wait, &WaitError{Err: err, Exhausted: !waitStart.IsZero()}
+		}
+
+		e, ok := pool.reserve()
+		handed := !ok
+		if !ok {
+			if !block {
+				pool.mu.Unlock()
+				return nil, wait, ErrPoolExhausted
 			}
-			return item, true
-		default:
-			pool.mu.Lock()
-			if pool.current < pool.max {
-				pool.current++
+
+			if pool.maxWaiters > 0 && uint(len(pool.waiters)) >= pool.maxWaiters {
 				pool.mu.Unlock()
-				return pool.new(), true
+				atomic.AddInt64(&pool.stats.shed, 1)
+				return nil, wait, ErrPoolExhausted
 			}
+
+			// queue is overloaded, so wait is limited by the target
+			var timeout <-chan time.Time
+			if pool.shed.shedding(pool.now(), len(pool.waiters) > 0) {
+				if shedTimer != nil {
+					shedTimer.Stop()
+				}
+				shedTimer = time.NewTimer(pool.shed.target)
+				timeout = shedTimer.C
+			}
+
+			// wait for item or slot handed off by notify, for pool to be
+			// closed or for ctx to be done
+			w := pool.enqueue(priorityOf(ctx))
 			pool.mu.Unlock()
-			// wait for released item
-			if item, ok := <-pool.queue; ok {
-				return item, true
+
+			if waitStart.IsZero() {
+				waitStart = pool.now()
 			}
-			// nothing to return
-			var zero T
-			return zero, false
+
+			select {
+			case e, ok = <-w:
+				if !ok {
+					continue
+				}
+			case <-timeout:
+				pool.mu.Lock()
+				pool.abandon(w)
+				pool.shed.observe(pool.now().Sub(waitStart))
+				pool.mu.Unlock()
+				atomic.AddInt64(&pool.stats.shed, 1)
+				return nil, wait, ErrPoolExhausted
+			case <-ctx.Done():
+				pool.mu.Lock()
+				pool.abandon(w)
+				pool.mu.Unlock()
+				return nil, wait, &WaitError{Err: ctx.Err(), Exhausted: true}
+			}
+			pool.mu.Lock()
 		}
+
+		if e == nil {
+			pool.mu.Unlock()
+			e, err := pool.create(ctx)
+			return e, wait, err
+		}
+
+		if reason, ok := pool.expired(e, pool.now()); ok && handed {
+			// replace in the same slot to keep the place in the queue
+			pool.mu.Unlock()
+			pool.drop(reason, e)
+			e, err := pool.create(ctx)
+			return e, wait, err
+		} else if ok {
+			pool.giveback()
+			pool.current--
+			pool.notify()
+			pool.mu.Unlock()
+			pool.drop(reason, e)
+			continue
+		}
+		pool.track(e)
+		pool.mu.Unlock()
+		if pool.checked(e) || pool.valid(e) {
+			return e, wait, nil
+		}
+		pool.drop(DestroyCheckFailed, e)
+		if attempts++; attempts >= maxCheckAttempts || handed {
+			// too many invalid items in a row or item was handed off to
+			// waiter, replace in the same slot
+			pool.mu.Lock()
+			pool.untrackEntry(e)
+			pool.mu.Unlock()
+			e, err := pool.create(ctx)
+			return e, wait, err
+		}
+		// free the slot and try next item
+		pool.mu.Lock()
+		pool.untrackEntry(e)
+		pool.giveback()
+		pool.current--
+		pool.notify()
+		pool.mu.Unlock()
+	}
+}
+
+// create makes new item in already reserved slot, the slot is freed if factory fails
+func (pool *limitedPool[T]) create(ctx context.Context) (*entry[T], error) {
+	e, err := pool.spawn(ctx)
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if err != nil {
+		pool.giveback()
+		pool.current--
+		pool.notify()
+		return nil, err
 	}
+	pool.track(e)
+	return e, nil
 }
 
 func (pool *limitedPool[T]) Put(item T) {
-	select {
-	case pool.queue <- item:
+	pool.mu.Lock()
+	e, borrowed, err := pool.receive(item)
+	if err != nil {
+		pool.mu.Unlock()
+		pool.misuse(item, err)
 		return
-	default:
-		// pool is full or destroyed, destroy item
-		if pool.release != nil {
-			pool.release(item)
-		}
+	}
+	if pool.stale(e) {
 		return
 	}
+	pool.returned(e)
+	pool.restore(e, borrowed)
 }
 
-func (pool *limitedPool[T]) destroy() {
+// putEntry returns leased item to the pool
+func (pool *limitedPool[T]) putEntry(e *entry[T]) {
 	pool.mu.Lock()
-	defer pool.mu.Unlock()
-	if pool.queue == nil {
-		// pool is aleardy destroyed
+	if !pool.receiveEntry(e) {
 		return
 	}
-	close(pool.queue)
-	for item := range pool.queue {
-		if pool.release != nil {
-			pool.release(item)
+	if pool.stale(e) {
+		return
+	}
+	pool.returned(e)
+	pool.restore(e, true)
+}
+
+// restore keeps returned item in the pool or releases it, borrowed is false
+// for foreign item. It must be called with mu held and it releases mu.
+func (pool *limitedPool[T]) restore(e *entry[T], borrowed bool) {
+	if borrowed {
+		pool.giveback()
+	}
+	reason, expired := pool.outlived(e, pool.now())
+	// foreign item is accepted only if it fits into the limit, borrowed item
+	// may be above the limit if it was lowered
+	fits := pool.current < pool.max || (borrowed && pool.current <= pool.max)
+	// item is handed off to waiter even if there is no room for idle item
+	keep := uint(len(pool.idle)) < pool.maxIdle || len(pool.waiters) > 0
+	if !pool.closed && fits && keep && !expired {
+		if !borrowed {
+			pool.current++
 		}
+		pool.pushIdle(e)
+		pool.notify()
+		pool.mu.Unlock()
+		return
+	}
+	if borrowed {
+		pool.current--
+		pool.notify()
 	}
-	pool.queue = nil
-	pool.max = 0
-	pool.current = 0
+	if pool.closed {
+		reason = DestroyClosed
+	} else if !expired {
+		reason = DestroyIdleFull
+	}
+	pool.mu.Unlock()
+
+	pool.drop(reason, e)
+}
+
+// Discard releases borrowed item instead of returning it to the pool and
+// frees its slot, it should be used for broken items
+func (pool *limitedPool[T]) Discard(item T) {
+	pool.mu.Lock()
+	e, borrowed, err := pool.receive(item)
+	if err != nil {
+		pool.mu.Unlock()
+		pool.misuse(item, err)
+		return
+	}
+	if pool.stale(e) {
+		return
+	}
+	pool.discard(e, borrowed)
+}
+
+// discardEntry releases leased item
+func (pool *limitedPool[T]) discardEntry(e *entry[T]) {
+	pool.mu.Lock()
+	if !pool.receiveEntry(e) {
+		return
+	}
+	if pool.stale(e) {
+		return
+	}
+	pool.discard(e, true)
+}
+
+// discard releases item and frees its slot if item was borrowed, it must be
+// called with mu held and it releases mu
+func (pool *limitedPool[T]) discard(e *entry[T], borrowed bool) {
+	if borrowed {
+		pool.giveback()
+		pool.current--
+		pool.notify()
+	}
+	pool.mu.Unlock()
+
+	pool.drop(DestroyDiscarded, e)
+}
+
+// Close stops the pool: blocked and new Get calls fail with ErrPoolClosed,
+// borrowed items are released on Put. Close waits until all borrowed items
+// are returned or ctx is done, and then releases idle items.
+func (pool *limitedPool[T]) Close(ctx context.Context) error {
+	pool.mu.Lock()
+	drained, ok := pool.markClosed()
+	pool.mu.Unlock()
+	if !ok {
+		return ErrPoolClosed
+	}
+
+	err := pool.waitDrained(ctx, drained)
+	if derr := pool.destroy(ctx); err == nil {
+		err = derr
+	}
+	return err
+}
+
+// destroy closes the pool and releases idle items, it waits for background
+// refill until ctx is done
+func (pool *limitedPool[T]) destroy(ctx context.Context) error {
+	pool.mu.Lock()
+	pool.markClosed()
+	pool.mu.Unlock()
+	err := pool.waitFiller(ctx)
+
+	pool.mu.Lock()
+	entries := pool.takeIdle()
+	pool.mu.Unlock()
+
+	pool.drop(DestroyClosed, entries...)
+	return err
 }
@@ -1,18 +1,25 @@
 package mpool
 
 import (
+	"context"
+	"errors"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
-func TestBasicLimitedPool_NoQueue(t *testing.T) {
+func TestBasicLimitedPool_Destroyed(t *testing.T) {
 	pool := &limitedPool[*MyType]{}
 
-	pool.new = func() *MyType {
+	pool.new = simpleFactory(func() *MyType {
 		return &MyType{}
-	}
+	})
+
+	pool.destroy(context.Background())
 
 	v, _ := pool.Get()
 	if v != nil {
@@ -26,29 +33,28 @@ func TestBasicLimitedPool_NoQueue(t *testing.T) {
 		t.Error("Expected nil")
 		t.FailNow()
 	}
-
-	pool.destroy()
 }
 
 func TestBasicLimitedPool_OneItemQueue(t *testing.T) {
 	pool := &limitedPool[*MyType]{}
 
-	pool.new = func() *MyType {
+	pool.new = simpleFactory(func() *MyType {
 		return &MyType{Value: 1}
-	}
+	})
 
-	pool.queue = make(chan *MyType, 1)
 	pool.max = 1
+	pool.maxIdle = 1
 
-	if v, _ := pool.Get(); v.Value != 1 {
+	v, _ := pool.Get()
+	if v.Value != 1 {
 		t.Error("Expected 1")
 		t.FailNow()
 	}
 
-	pool.new = func() *MyType {
+	pool.new = simpleFactory(func() *MyType {
 		return &MyType{Value: 2}
-	}
-	pool.Put(&MyType{Value: 1})
+	})
+	pool.Put(v)
 
 	if v, _ := pool.Get(); v.Value != 1 {
 		t.Error("Expected 1")
@@ -70,10 +76,10 @@ func TestBasicLimitedPool_Callbacks(t *testing.T) {
 		flagcheckcalled   bool
 	)
 
-	pool.new = func() *MyType {
+	pool.new = simpleFactory(func() *MyType {
 		flagnewcalled = true
 		return &MyType{Value: 1}
-	}
+	})
 
 	pool.check = func(v *MyType) bool {
 		flagcheckcalled = true
@@ -92,10 +98,11 @@ func TestBasicLimitedPool_Callbacks(t *testing.T) {
 		}
 	}
 
-	pool.queue = make(chan *MyType, 1)
 	pool.max = 1
+	pool.maxIdle = 1
 
-	if v, _ := pool.Get(); v.Value != 1 {
+	v, _ := pool.Get()
+	if v.Value != 1 {
 		t.Error("Expected 1")
 		t.FailNow()
 	}
@@ -122,11 +129,11 @@ func TestBasicLimitedPool_Callbacks(t *testing.T) {
 
 	flagnewcalled = false
 
-	pool.new = func() *MyType {
+	pool.new = simpleFactory(func() *MyType {
 		flagnewcalled = true
 		return &MyType{Value: 2}
-	}
-	pool.Put(&MyType{Value: 1})
+	})
+	pool.Put(v)
 
 	if flagnewcalled {
 		t.Error("New callback was called as NOT expected")
@@ -143,7 +150,8 @@ func TestBasicLimitedPool_Callbacks(t *testing.T) {
 		t.FailNow()
 	}
 
-	if v, _ := pool.Get(); v.Value != 1 {
+	v, _ = pool.Get()
+	if v.Value != 1 {
 		t.Error("Expected 1")
 		t.FailNow()
 	}
@@ -164,7 +172,8 @@ func TestBasicLimitedPool_Callbacks(t *testing.T) {
 	}
 
 	flagcheckcalled = false
-	pool.Put(&MyType{Value: 2}) // Should be kept
+	v.Value = 2
+	pool.Put(v)                 // Should be kept
 	pool.Put(&MyType{Value: 1}) // Should be released
 
 	if pool.current != 1 {
@@ -191,10 +200,10 @@ func TestBasicLimitedPool_Callbacks(t *testing.T) {
 	flagcheckcalled = false
 	flagreleasecalled = false
 
-	pool.new = func() *MyType {
+	pool.new = simpleFactory(func() *MyType {
 		flagnewcalled = true
 		return &MyType{Value: 3}
-	}
+	})
 
 	pool.check = func(v *MyType) bool {
 		flagcheckcalled = true
@@ -285,7 +294,8 @@ func TestBasicLimitedPool_API(t *testing.T) {
 	}
 
 	flagnewcalled = false
-	if v, _ := pool.Get(); v.Value != 1 {
+	v, _ := pool.Get()
+	if v.Value != 1 {
 		t.Error("Expected 1")
 		t.FailNow()
 	}
@@ -306,7 +316,8 @@ func TestBasicLimitedPool_API(t *testing.T) {
 	}
 
 	flagcheckcalled = false
-	pool.Put(&MyType{Value: 2}) // Should be kept
+	v.Value = 2
+	pool.Put(v)                 // Should be kept
 	pool.Put(&MyType{Value: 1}) // Should be released
 
 	if flagnewcalled {
@@ -438,24 +449,26 @@ func TestBasicLimitedPool_APIOtherType(t *testing.T) {
 	var wd sync.WaitGroup
 	wd.Add(1)
 	go func() {
+		defer wd.Done()
 		if v, _ := pool.Get(); v != 1 {
 			t.Error("Expected 1")
-			t.FailNow()
 		}
-		wd.Done()
 	}()
 	time.Sleep(time.Second)
 	pool.Put(1) // Should be passed to go routine
 	wd.Wait()
 
 	wd.Add(1)
-	go func() {
-		wd.Done()
+	go func(pool Pool[int]) {
+		defer wd.Done()
 		if _, b := pool.Get(); b {
 			t.Error("Expected false")
-			t.FailNow()
 		}
-	}()
+	}(pool)
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pool.Close(ctx) // Should wake up go routine
 	wd.Wait()
 
 	raw.check = func(v int) bool {
@@ -524,3 +537,1937 @@ func TestBasicLimitedPool_APIError(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestBasicLimitedPool_GetContext(t *testing.T) {
+	pool, err := NewLimitedPool(1, 1, func() int { return 1 }, nil, nil)
+
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	if v, err := pool.GetContext(context.Background()); err != nil || v != 1 {
+		t.Error("Expected 1 without error")
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = pool.GetContext(ctx)
+	var werr *WaitError
+	if !errors.As(err, &werr) {
+		t.Error("Expected WaitError", err)
+		t.FailNow()
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Expected DeadlineExceeded", err)
+		t.FailNow()
+	}
+
+	if !errors.Is(err, ErrWaitTimeout) || !errors.Is(err, ErrPoolExhausted) {
+		t.Error("Expected ErrWaitTimeout and ErrPoolExhausted", err)
+		t.FailNow()
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := pool.GetContext(ctx)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) || errors.Is(err, ErrWaitTimeout) {
+		t.Error("Expected Canceled", err)
+		t.FailNow()
+	}
+
+	// waiter was removed, so released item should stay in the pool
+	pool.Put(1)
+	if v, err := pool.GetContext(context.Background()); err != nil || v != 1 {
+		t.Error("Expected 1 without error")
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_Close(t *testing.T) {
+	var released int32
+
+	pool, err := NewLimitedPool(1, 2, func() int { return 1 }, func(int) {
+		atomic.AddInt32(&released, 1)
+	}, nil)
+
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	v1, _ := pool.Get()
+	v2, _ := pool.Get()
+
+	done := make(chan error)
+	go func() {
+		_, err := pool.GetContext(context.Background())
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan error)
+	go func() {
+		closed <- pool.Close(context.Background())
+	}()
+
+	if err := <-done; err != ErrPoolClosed {
+		t.Error("Expected ErrPoolClosed for waiter", err)
+		t.FailNow()
+	}
+
+	if _, err := pool.GetContext(context.Background()); err != ErrPoolClosed {
+		t.Error("Expected ErrPoolClosed", err)
+		t.FailNow()
+	}
+
+	pool.Put(v1)
+	select {
+	case <-closed:
+		t.Error("Close is expected to wait for borrowed items")
+		t.FailNow()
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pool.Put(v2)
+	if err := <-closed; err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	if atomic.LoadInt32(&released) != 2 {
+		t.Error("Expected 2 released items", released)
+		t.FailNow()
+	}
+
+	if err := pool.Close(context.Background()); err != ErrPoolClosed {
+		t.Error("Expected ErrPoolClosed", err)
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_CloseTimeout(t *testing.T) {
+	var released int32
+
+	pool, err := NewLimitedPool(2, 2, func() int { return 1 }, func(int) {
+		atomic.AddInt32(&released, 1)
+	}, nil)
+
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	v, _ := pool.Get()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := pool.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Expected DeadlineExceeded", err)
+		t.FailNow()
+	}
+
+	// idle item is force released
+	if atomic.LoadInt32(&released) != 1 {
+		t.Error("Expected 1 released item", released)
+		t.FailNow()
+	}
+
+	pool.Put(v)
+	if atomic.LoadInt32(&released) != 2 {
+		t.Error("Expected 2 released items", released)
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_FactoryError(t *testing.T) {
+	errFactory := errors.New("factory failed")
+	var (
+		fail     bool
+		released int
+	)
+
+	factory := func(ctx context.Context) (int, error) {
+		if fail {
+			return 0, errFactory
+		}
+		return 1, nil
+	}
+
+	fail = true
+	_, err := NewLimitedPoolWithFactory(context.Background(), 1, 1, factory, nil, nil)
+	if !errors.Is(err, errFactory) || !errors.Is(err, ErrFactoryFailed) {
+		t.Error("Expected factory error", err)
+		t.FailNow()
+	}
+
+	fail = false
+	pool, err := NewLimitedPoolWithFactory(context.Background(), 0, 1, factory, func(int) {
+		released++
+	}, func(int) bool {
+		return false
+	})
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*limitedPool[int])
+
+	fail = true
+	if _, err := pool.GetContext(context.Background()); !errors.Is(err, errFactory) {
+		t.Error("Expected factory error", err)
+		t.FailNow()
+	}
+
+	if raw.current != 0 {
+		t.Error("Expected slot to be released", raw.current)
+		t.FailNow()
+	}
+
+	fail = false
+	v, err := pool.GetContext(context.Background())
+	if err != nil || v != 1 {
+		t.Error("Expected 1 without error")
+		t.FailNow()
+	}
+	pool.Put(v)
+
+	// check fails and replacement cannot be created
+	fail = true
+	if _, err := pool.GetContext(context.Background()); !errors.Is(err, errFactory) {
+		t.Error("Expected factory error", err)
+		t.FailNow()
+	}
+
+	if released != 1 {
+		t.Error("Expected invalid item to be released", released)
+		t.FailNow()
+	}
+
+	if raw.current != 0 {
+		t.Error("Expected slot to be released", raw.current)
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_Discard(t *testing.T) {
+	var released int
+
+	pool, err := NewLimitedPool(0, 1, func() int { return 1 }, func(int) {
+		released++
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*limitedPool[int])
+
+	v, _ := pool.Get()
+	pool.Discard(v)
+
+	if raw.current != 0 || raw.inuse != 0 {
+		t.Error("Expected slot to be freed", raw.current, raw.inuse)
+		t.FailNow()
+	}
+
+	if released != 1 {
+		t.Error("Expected discarded item to be released", released)
+		t.FailNow()
+	}
+
+	// slot is available again without waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := pool.GetContext(ctx); err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	if raw.current != 1 || raw.inuse != 1 {
+		t.Error("Expected 1 live borrowed item", raw.current, raw.inuse)
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_LiveAccounting(t *testing.T) {
+	const (
+		max     = 4
+		workers = 16
+		rounds  = 500
+	)
+
+	var (
+		live     int32
+		overflow int32
+		checks   int32
+	)
+
+	pool, err := NewLimitedPool(0, max, func() int {
+		if atomic.AddInt32(&live, 1) > max {
+			atomic.StoreInt32(&overflow, 1)
+		}
+		return 1
+	}, func(int) {
+		atomic.AddInt32(&live, -1)
+	}, func(int) bool {
+		return atomic.AddInt32(&checks, 1)%5 != 0
+	})
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*limitedPool[int])
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				v, ok := pool.Get()
+				if !ok {
+					t.Error("Expected item")
+					return
+				}
+				if (w+i)%7 == 0 {
+					pool.Discard(v)
+				} else {
+					pool.Put(v)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&overflow) != 0 {
+		t.Error("Live items exceeded max")
+		t.FailNow()
+	}
+
+	raw.mu.Lock()
+	current, inuse, idle := raw.current, raw.inuse, len(raw.idle)
+	raw.mu.Unlock()
+
+	if inuse != 0 || int(current) != idle || int32(current) != atomic.LoadInt32(&live) {
+		t.Error("Accounting mismatch", current, inuse, idle, live)
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_ConcurrentClose(t *testing.T) {
+	const (
+		max     = 4
+		workers = 16
+	)
+
+	var created, released int32
+
+	pool, err := NewLimitedPool(max, max, func() int {
+		atomic.AddInt32(&created, 1)
+		return 1
+	}, func(int) {
+		atomic.AddInt32(&released, 1)
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				v, err := pool.GetContext(context.Background())
+				if err == ErrPoolClosed {
+					return
+				}
+				if err != nil {
+					t.Error("Unexpected error", err)
+					return
+				}
+				if (w+i)%5 == 0 {
+					pool.Discard(v)
+				} else {
+					pool.Put(v)
+				}
+			}
+		}(w)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if err := pool.Close(context.Background()); err != nil {
+		t.Error("Errror is not expected", err)
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&created) != atomic.LoadInt32(&released) {
+		t.Error("Expected all items to be released", created, released)
+		t.FailNow()
+	}
+
+	raw := pool.(*limitedPool[int])
+	if raw.current != 0 || raw.inuse != 0 || len(raw.idle) != 0 {
+		t.Error("Expected empty pool", raw.current, raw.inuse, len(raw.idle))
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_PutAfterClose(t *testing.T) {
+	var released []int
+
+	pool, err := NewLimitedPool(0, 2, func() int { return 1 }, func(v int) {
+		released = append(released, v)
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	v, _ := pool.Get()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pool.Close(ctx)
+
+	pool.Put(v)
+	pool.Put(2) // foreign item
+	if len(released) != 2 || released[0] != 1 || released[1] != 2 {
+		t.Error("Expected items to be released", released)
+		t.FailNow()
+	}
+
+	raw := pool.(*limitedPool[int])
+	if raw.current != 0 || len(raw.idle) != 0 {
+		t.Error("Expected empty pool", raw.current, len(raw.idle))
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_CheckWaitingPath(t *testing.T) {
+	var released []int
+
+	pool, err := NewLimitedPool(0, 1, func() int { return 1 }, func(v int) {
+		released = append(released, v)
+	}, func(v int) bool {
+		return v == 1
+	})
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	v, _ := pool.Get()
+
+	done := make(chan int)
+	go func() {
+		v, _ := pool.Get()
+		done <- v
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	pool.Put(2) // invalid item is handed off to waiting Get
+
+	if w := <-done; w != 1 {
+		t.Error("Expected invalid item to be replaced", w)
+		t.FailNow()
+	}
+
+	if len(released) != 1 || released[0] != 2 {
+		t.Error("Expected invalid item to be released", released)
+		t.FailNow()
+	}
+
+	pool.Discard(v)
+}
+
+func TestBasicLimitedPool_CheckAttempts(t *testing.T) {
+	var checks, released int
+
+	value := 0
+	pool, err := NewLimitedPool(5, 5, func() int {
+		value++
+		return value
+	}, func(int) {
+		released++
+	}, func(int) bool {
+		checks++
+		return false
+	})
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*limitedPool[int])
+
+	if v, _ := pool.Get(); v != 6 {
+		t.Error("Expected new item", v)
+		t.FailNow()
+	}
+
+	if checks != maxCheckAttempts || released != maxCheckAttempts {
+		t.Error("Expected bounded number of checks", checks, released)
+		t.FailNow()
+	}
+
+	if raw.current != 3 || len(raw.idle) != 2 {
+		t.Error("Expected 3 live items", raw.current, len(raw.idle))
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_MaxIdleTime(t *testing.T) {
+	var released int32
+
+	value := 0
+	pool, err := NewLimitedPool(2, 2, func() int {
+		value++
+		return value
+	}, func(int) {
+		atomic.AddInt32(&released, 1)
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*limitedPool[int])
+
+	// stale items are released on Get
+	raw.mu.Lock()
+	raw.maxIdleTime = 20 * time.Millisecond
+	raw.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+
+	if v, _ := pool.Get(); v != 3 {
+		t.Error("Expected new item", v)
+		t.FailNow()
+	}
+
+	if atomic.LoadInt32(&released) != 2 {
+		t.Error("Expected stale items to be released", released)
+		t.FailNow()
+	}
+
+	raw.mu.Lock()
+	current := raw.current
+	raw.mu.Unlock()
+	if current != 1 {
+		t.Error("Expected 1 live item", current)
+		t.FailNow()
+	}
+
+	// stale items are released by cleaner
+	pool.Put(3)
+	pool.SetMaxIdleTime(10 * time.Millisecond)
+	time.Sleep(3 * minCleanInterval)
+
+	raw.mu.Lock()
+	current, idle := raw.current, len(raw.idle)
+	raw.mu.Unlock()
+	if current != 0 || idle != 0 || atomic.LoadInt32(&released) != 3 {
+		t.Error("Expected stale item to be released by cleaner", current, idle, released)
+		t.FailNow()
+	}
+
+	pool.Close(context.Background())
+	time.Sleep(minCleanInterval)
+
+	raw.mu.Lock()
+	cleaner := raw.cleaner
+	raw.mu.Unlock()
+	if cleaner != nil {
+		t.Error("Expected cleaner to be stopped")
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_MaxUses(t *testing.T) {
+	var released []int
+
+	value := 0
+	pool, err := NewLimitedPool(0, 1, func() int {
+		value++
+		return value
+	}, func(v int) {
+		released = append(released, v)
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	pool.SetMaxUses(2)
+
+	for i, expected := range []int{1, 1, 2, 2, 3} {
+		v, _ := pool.Get()
+		if v != expected {
+			t.Error("Unexpected item", i, v)
+			t.FailNow()
+		}
+		pool.Put(v)
+	}
+
+	if len(released) != 2 || released[0] != 1 || released[1] != 2 {
+		t.Error("Expected used items to be released", released)
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_MaxLifetime(t *testing.T) {
+	var released []*MyType
+
+	pool, err := NewLimitedPool(1, 2, func() *MyType {
+		return &MyType{Value: 1}
+	}, func(v *MyType) {
+		released = append(released, v)
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*limitedPool[*MyType])
+
+	for _, e := range raw.idle {
+		if e.jitter < 0 || e.jitter >= lifetimeJitter {
+			t.Error("Unexpected jitter", e.jitter)
+			t.FailNow()
+		}
+	}
+
+	raw.mu.Lock()
+	raw.maxLifetime = 30 * time.Millisecond
+	raw.mu.Unlock()
+
+	v1, _ := pool.Get()
+	time.Sleep(50 * time.Millisecond)
+
+	// old idle item is released on Get
+	v2, _ := pool.Get()
+	if v1 == v2 || len(released) != 0 {
+		t.Error("Expected new item")
+		t.FailNow()
+	}
+
+	// old borrowed item is released on Put
+	pool.Put(v1)
+	if len(released) != 1 || released[0] != v1 {
+		t.Error("Expected old item to be released", released)
+		t.FailNow()
+	}
+
+	pool.Put(v2)
+	if len(released) != 1 || len(raw.idle) != 1 {
+		t.Error("Expected new item to be kept", released)
+		t.FailNow()
+	}
+
+	// expired idle item is released when limit is changed
+	time.Sleep(50 * time.Millisecond)
+	pool.SetMaxLifetime(30 * time.Millisecond)
+	if len(released) != 2 || len(raw.idle) != 0 || raw.current != 0 {
+		t.Error("Expected idle item to be released", released)
+		t.FailNow()
+	}
+
+	pool.Close(context.Background())
+}
+
+func TestBasicLimitedPool_Stats(t *testing.T) {
+	var checks int32
+
+	pool, err := NewLimitedPool(1, 2, func() int { return 1 }, nil, func(v int) bool {
+		// first returned item is invalid
+		return atomic.AddInt32(&checks, 1) != 2
+	})
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	stats := pool.Stats()
+	if stats.MaxOpen != 2 || stats.Open != 1 || stats.Idle != 1 || stats.InUse != 0 || stats.Created != 1 {
+		t.Error("Unexpected stats", stats)
+		t.FailNow()
+	}
+
+	v1, _ := pool.Get()
+	v2, _ := pool.Get()
+
+	stats = pool.Stats()
+	if stats.Open != 2 || stats.Idle != 0 || stats.InUse != 2 || stats.Created != 2 {
+		t.Error("Unexpected stats", stats)
+		t.FailNow()
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		pool.Put(v1)
+	}()
+
+	v3, _ := pool.Get()
+
+	stats = pool.Stats()
+	if stats.WaitCount != 1 || stats.WaitDuration < 50*time.Millisecond {
+		t.Error("Unexpected wait stats", stats)
+		t.FailNow()
+	}
+
+	if stats.Released != 1 || stats.CheckFailures != 1 || stats.Created != 3 || stats.Open != 2 || stats.InUse != 2 {
+		t.Error("Unexpected stats", stats)
+		t.FailNow()
+	}
+
+	pool.SetMaxUses(1)
+	pool.Put(v2)
+	pool.Put(v3)
+
+	// values borrowed before the limit was set start counting uses on return
+	v2, _ = pool.Get()
+	v3, _ = pool.Get()
+	pool.Put(v2)
+	pool.Put(v3)
+	stats = pool.Stats()
+	if stats.MaxUsesClosed != 2 || stats.Released != 3 || stats.Open != 0 || stats.InUse != 0 {
+		t.Error("Unexpected stats", stats)
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_Hooks(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		created   int
+		borrowed  []ItemInfo
+		returned  int
+		destroyed []DestroyReason
+		failed    int
+	)
+
+	pool, err := NewLimitedPool(0, 1, func() *MyType {
+		return &MyType{}
+	}, nil, func(v *MyType) bool {
+		return v.Value >= 0
+	})
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	pool.SetHooks(Hooks[*MyType]{
+		OnCreate: func(v *MyType, info ItemInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			created++
+		},
+		OnBorrow: func(v *MyType, info ItemInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			borrowed = append(borrowed, info)
+		},
+		OnReturn: func(v *MyType, info ItemInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			returned++
+			v.Value = 0 // reset state
+		},
+		OnDestroy: func(v *MyType, info ItemInfo, reason DestroyReason) {
+			mu.Lock()
+			defer mu.Unlock()
+			destroyed = append(destroyed, reason)
+		},
+		OnCheckFail: func(v *MyType, info ItemInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed++
+		},
+	})
+
+	v, _ := pool.Get()
+	v.Value = 5
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		pool.Put(v)
+	}()
+
+	if v2, _ := pool.Get(); v2 != v || v2.Value != 0 {
+		t.Error("Expected the same reset item")
+		t.FailNow()
+	}
+
+	mu.Lock()
+	if created != 1 || returned != 1 || len(borrowed) != 2 {
+		t.Error("Unexpected hook calls", created, returned, len(borrowed))
+		t.FailNow()
+	}
+
+	if borrowed[1].Uses != 2 || borrowed[1].Wait < 50*time.Millisecond || borrowed[1].Age < borrowed[1].Wait {
+		t.Error("Unexpected item info", borrowed[1])
+		t.FailNow()
+	}
+	mu.Unlock()
+
+	pool.Discard(v)
+
+	v, _ = pool.Get()
+	pool.SetHooks(Hooks[*MyType]{
+		OnReturn: func(v *MyType, info ItemInfo) {
+			v.Value = -1 // make item invalid
+		},
+		OnDestroy: func(v *MyType, info ItemInfo, reason DestroyReason) {
+			mu.Lock()
+			defer mu.Unlock()
+			destroyed = append(destroyed, reason)
+		},
+		OnCheckFail: func(v *MyType, info ItemInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed++
+		},
+	})
+	pool.Put(v)
+	v, _ = pool.Get()
+	pool.Put(v)
+	pool.Close(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if failed != 1 {
+		t.Error("Expected check fail hook to be called", failed)
+		t.FailNow()
+	}
+
+	expected := []DestroyReason{DestroyDiscarded, DestroyCheckFailed, DestroyClosed}
+	if len(destroyed) != len(expected) {
+		t.Error("Unexpected destroy reasons", destroyed)
+		t.FailNow()
+	}
+	for i := range expected {
+		if destroyed[i] != expected[i] {
+			t.Error("Unexpected destroy reasons", destroyed)
+			t.FailNow()
+		}
+	}
+}
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestBasicLimitedPool_New(t *testing.T) {
+	var released int
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	pool, err := New(func(context.Context) (*MyType, error) {
+		return &MyType{}, nil
+	},
+		WithMaxOpen(2),
+		WithMinIdle(1),
+		WithRelease(func(*MyType) { released++ }),
+		WithCheck(func(*MyType) bool { return true }),
+		WithIdleTimeout(time.Hour),
+		WithClock(clock),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+	raw, ok := pool.(*limitedPool[*MyType])
+	if !ok {
+		t.Error("Expected limited pool")
+		t.FailNow()
+	}
+
+	if raw.max != 2 || len(raw.idle) != 1 || raw.release == nil || raw.check == nil {
+		t.Error("Expected options to be applied", raw.max, len(raw.idle))
+		t.FailNow()
+	}
+
+	clock.Add(2 * time.Hour)
+	v, _ := pool.Get()
+	if released != 1 {
+		t.Error("Expected idle item to expire by pool clock", released)
+		t.FailNow()
+	}
+
+	pool.Put(v)
+	pool.Close(context.Background())
+
+	_, err = New(func(context.Context) (int, error) { return 1, nil }, WithMaxOpen(2), WithMaxIdle(3))
+	var optErr *OptionError
+	if !errors.As(err, &optErr) || optErr.Option != "WithMaxIdle" {
+		t.Error("Expected WithMaxIdle error", err)
+		t.FailNow()
+	}
+
+	_, err = New(func(context.Context) (int, error) { return 1, nil }, WithMaxOpen(2), WithMinIdle(3))
+	if !errors.As(err, &optErr) || optErr.Option != "WithMinIdle" || !errors.Is(err, ErrorInvalidParameters) {
+		t.Error("Expected WithMinIdle error", err)
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_TryGet(t *testing.T) {
+	var created int
+
+	pool, err := NewLimitedPool(1, 2, func() int {
+		created++
+		return created
+	}, nil, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*limitedPool[int])
+
+	v1, ok := pool.TryGet()
+	if !ok || v1 != 1 {
+		t.Error("Expected idle item", v1)
+		t.FailNow()
+	}
+
+	v2, ok := pool.TryGet()
+	if !ok || v2 != 2 {
+		t.Error("Expected new item below the limit", v2)
+		t.FailNow()
+	}
+
+	if _, ok := pool.TryGet(); ok {
+		t.Error("Expected false at the limit")
+		t.FailNow()
+	}
+
+	if created != 2 || raw.current != 2 || raw.inuse != 2 {
+		t.Error("Expected no item beyond the limit", created, raw.current, raw.inuse)
+		t.FailNow()
+	}
+
+	pool.Put(v1)
+	if v, ok := pool.TryGet(); !ok || v != 1 {
+		t.Error("Expected returned item", v)
+		t.FailNow()
+	}
+
+	pool.Put(v1)
+	pool.Put(v2)
+	pool.Close(context.Background())
+	if _, ok := pool.TryGet(); ok {
+		t.Error("Expected false for closed pool")
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_MaxIdle(t *testing.T) {
+	var released int32
+
+	pool, err := New(func(context.Context) (int, error) { return 1, nil },
+		WithMaxOpen(3),
+		WithMaxIdle(1),
+		WithRelease(func(int) { atomic.AddInt32(&released, 1) }),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+	raw := pool.(*limitedPool[int])
+
+	items := make([]int, 3)
+	for i := range items {
+		items[i], _ = pool.Get()
+	}
+	for _, v := range items {
+		pool.Put(v)
+	}
+
+	if raw.current != 1 || len(raw.idle) != 1 || atomic.LoadInt32(&released) != 2 {
+		t.Error("Expected items above idle limit to be released", raw.current, len(raw.idle), released)
+		t.FailNow()
+	}
+
+	limited, ok := pool.(LimitedPool[int])
+	if !ok {
+		t.Error("Expected LimitedPool")
+		t.FailNow()
+	}
+
+	limited.SetMaxIdle(5)
+	if stats := pool.Stats(); stats.MaxIdle != 3 {
+		t.Error("Expected idle limit to be capped by MaxOpen", stats.MaxIdle)
+		t.FailNow()
+	}
+
+	v1, _ := pool.Get()
+	v2, _ := pool.Get()
+	limited.SetMaxOpen(1)
+	if stats := pool.Stats(); stats.MaxOpen != 1 || stats.MaxIdle != 1 {
+		t.Error("Expected limits to be lowered", stats.MaxOpen, stats.MaxIdle)
+		t.FailNow()
+	}
+
+	// borrowed items above new limit are released on Put
+	pool.Put(v1)
+	pool.Put(v2)
+	if raw.current != 1 || atomic.LoadInt32(&released) != 3 {
+		t.Error("Expected item above the limit to be released", raw.current, released)
+		t.FailNow()
+	}
+
+	v1, _ = pool.Get()
+	done := make(chan int)
+	go func() {
+		v, _ := pool.Get()
+		done <- v
+	}()
+	time.Sleep(50 * time.Millisecond)
+	limited.SetMaxOpen(2)
+
+	select {
+	case v2 = <-done:
+	case <-time.After(time.Second):
+		t.Error("Expected waiter to get item after limit is raised")
+		t.FailNow()
+	}
+
+	pool.Put(v1)
+	pool.Put(v2)
+	pool.Close(context.Background())
+}
+
+func TestBasicLimitedPool_MinIdle(t *testing.T) {
+	var (
+		calls int32
+		fail  int32 = 2
+	)
+
+	pool, err := New(func(context.Context) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.AddInt32(&fail, -1) >= 0 {
+			return 0, errors.New("factory failed")
+		}
+		return 1, nil
+	},
+		WithMaxOpen(3),
+		WithMaxIdle(2),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	idle := func() int {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			stats := pool.Stats()
+			if stats.Idle == 2 || time.Now().After(deadline) {
+				return stats.Idle
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	pool.SetMinIdle(2)
+	if n := idle(); n != 2 || atomic.LoadInt32(&calls) != 4 {
+		t.Error("Expected idle items to be refilled after factory failures", n, calls)
+		t.FailNow()
+	}
+
+	v1, _ := pool.Get()
+	v2, _ := pool.Get()
+	if n := idle(); n != 1 {
+		t.Error("Expected refill to respect MaxOpen", n)
+		t.FailNow()
+	}
+
+	pool.Discard(v1)
+	if n := idle(); n != 2 {
+		t.Error("Expected idle items to be refilled", n)
+		t.FailNow()
+	}
+
+	pool.Put(v2)
+	if err := pool.Close(context.Background()); err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	created := atomic.LoadInt32(&calls)
+	time.Sleep(2 * minFillBackoff)
+	if atomic.LoadInt32(&calls) != created {
+		t.Error("Expected refill to stop on Close")
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_FairHandoff(t *testing.T) {
+	pool, err := NewLimitedPool(1, 1, func() int { return 1 }, nil, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	v, _ := pool.Get()
+
+	const waiters = 4
+	order := make(chan int, waiters)
+	var wg sync.WaitGroup
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, _ := pool.Get()
+			order <- i
+			time.Sleep(10 * time.Millisecond)
+			pool.Put(v)
+		}(i)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	pool.Put(v)
+	// item is handed off to the oldest waiter, so it cannot be stolen
+	if _, ok := pool.TryGet(); ok {
+		t.Error("Expected waiters not to be overtaken")
+		t.FailNow()
+	}
+
+	wg.Wait()
+	close(order)
+	next := 0
+	for i := range order {
+		if i != next {
+			t.Error("Expected waiters to be served in arrival order", i, next)
+			t.FailNow()
+		}
+		next++
+	}
+
+	if err := pool.Close(context.Background()); err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+}
+
+// chanPool is limited pool built on buffered channel, it is the reference
+// for hand-off benchmarks
+type chanPool struct {
+	queue   chan int
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (p *chanPool) Get() int {
+	select {
+	case v := <-p.queue:
+		return v
+	default:
+	}
+	p.mu.Lock()
+	if p.current < p.max {
+		p.current++
+		p.mu.Unlock()
+		return 1
+	}
+	p.mu.Unlock()
+	return <-p.queue
+}
+
+func (p *chanPool) Put(v int) {
+	p.queue <- v
+}
+
+// benchmarkSaturated runs Get and Put from many goroutines sharing few items
+// and reports wait latency percentiles
+func benchmarkSaturated(b *testing.B, get func() int, put func(int)) {
+	var (
+		mu    sync.Mutex
+		waits []time.Duration
+	)
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		local := make([]time.Duration, 0, 1024)
+		for pb.Next() {
+			start := time.Now()
+			v := get()
+			local = append(local, time.Since(start))
+			runtime.Gosched()
+			put(v)
+		}
+		mu.Lock()
+		waits = append(waits, local...)
+		mu.Unlock()
+	})
+	b.StopTimer()
+
+	if len(waits) == 0 {
+		return
+	}
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	b.ReportMetric(float64(waits[len(waits)*99/100]), "p99-ns")
+	b.ReportMetric(float64(waits[len(waits)-1]), "max-ns")
+}
+
+func BenchmarkLimitedPool_Saturated(b *testing.B) {
+	pool, err := NewLimitedPool(0, 4, func() int { return 1 }, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkSaturated(b, func() int {
+		v, _ := pool.Get()
+		return v
+	}, pool.Put)
+	pool.Close(context.Background())
+}
+
+func BenchmarkChanPool_Saturated(b *testing.B) {
+	pool := &chanPool{queue: make(chan int, 4), max: 4}
+	benchmarkSaturated(b, pool.Get, pool.Put)
+}
+
+func TestBasicLimitedPool_IdleStrategy(t *testing.T) {
+	var created int
+
+	pool, err := New(func(context.Context) (int, error) {
+		created++
+		return created, nil
+	},
+		WithMaxOpen(3),
+		WithMinIdle(3),
+		WithIdleStrategy(IdleLIFO),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	if v, _ := pool.Get(); v != 3 {
+		t.Error("Expected the newest item", v)
+		t.FailNow()
+	} else {
+		pool.Put(v)
+	}
+
+	pool.SetIdleStrategy(IdleFIFO)
+	if v, _ := pool.Get(); v != 1 {
+		t.Error("Expected the oldest item", v)
+		t.FailNow()
+	} else {
+		pool.Put(v)
+	}
+
+	pool.SetIdleStrategy(IdleRandom)
+	seen := map[int]bool{}
+	for i := 0; i < 100; i++ {
+		v, _ := pool.Get()
+		seen[v] = true
+		pool.Put(v)
+	}
+	if len(seen) != 3 {
+		t.Error("Expected random item", seen)
+		t.FailNow()
+	}
+
+	pool.Close(context.Background())
+
+	_, err = New(func(context.Context) (int, error) { return 1, nil }, WithIdleStrategy(IdleStrategy(-1)))
+	var optErr *OptionError
+	if !errors.As(err, &optErr) || optErr.Option != "WithIdleStrategy" {
+		t.Error("Expected WithIdleStrategy error", err)
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_Priority(t *testing.T) {
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	pool, err := New(func(context.Context) (int, error) { return 1, nil },
+		WithMaxOpen(1),
+		WithClock(clock),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	served := func(first, second Priority, age time.Duration) []Priority {
+		v, _ := pool.Get()
+		order := make(chan Priority, 2)
+		var wg sync.WaitGroup
+		for _, p := range []Priority{first, second} {
+			wg.Add(1)
+			go func(p Priority) {
+				defer wg.Done()
+				v, err := pool.GetContext(ContextWithPriority(context.Background(), p))
+				if err != nil {
+					return
+				}
+				order <- p
+				pool.Put(v)
+			}(p)
+			time.Sleep(20 * time.Millisecond)
+			clock.Add(age)
+		}
+		pool.Put(v)
+		wg.Wait()
+		close(order)
+		var result []Priority
+		for p := range order {
+			result = append(result, p)
+		}
+		return result
+	}
+
+	if order := served(PriorityLow, PriorityHigh, 0); len(order) != 2 || order[0] != PriorityHigh {
+		t.Error("Expected high priority waiter to be served first", order)
+		t.FailNow()
+	}
+
+	// low priority waiter aged by 3 classes overtakes high priority one
+	if order := served(PriorityLow, PriorityHigh, 3*time.Second); len(order) != 2 || order[0] != PriorityLow {
+		t.Error("Expected aged low priority waiter to be served first", order)
+		t.FailNow()
+	}
+
+	pool.Close(context.Background())
+}
+
+func TestBasicLimitedPool_MaxWaiters(t *testing.T) {
+	pool, err := New(func(context.Context) (int, error) { return 1, nil },
+		WithMaxOpen(1),
+		WithMaxWaiters(1),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	v, _ := pool.Get()
+	done := make(chan int)
+	go func() {
+		v, _ := pool.Get()
+		done <- v
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := pool.GetContext(context.Background()); err != ErrPoolExhausted {
+		t.Error("Expected ErrPoolExhausted", err)
+		t.FailNow()
+	}
+
+	if stats := pool.Stats(); stats.Shed != 1 {
+		t.Error("Expected rejected Get to be counted", stats.Shed)
+		t.FailNow()
+	}
+
+	pool.Put(v)
+	pool.Put(<-done)
+	pool.Close(context.Background())
+
+	_, err = New(func(context.Context) (int, error) { return 1, nil }, WithMaxWaiters(1))
+	var optErr *OptionError
+	if !errors.As(err, &optErr) || optErr.Option != "WithMaxWaiters" {
+		t.Error("Expected WithMaxWaiters error", err)
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_QueueTarget(t *testing.T) {
+	const (
+		target   = 50 * time.Millisecond
+		interval = 100 * time.Millisecond
+	)
+
+	pool, err := New(func(context.Context) (int, error) { return 1, nil },
+		WithMaxOpen(1),
+		WithQueueTarget(target, interval),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	wait := func() chan int {
+		done := make(chan int, 1)
+		go func() {
+			v, err := pool.GetContext(context.Background())
+			if err != nil {
+				v = -1
+			}
+			done <- v
+		}()
+		return done
+	}
+
+	v, _ := pool.Get()
+	a := wait()
+	time.Sleep(interval + target)
+
+	// nobody was served during the interval, so queue is overloaded
+	start := time.Now()
+	if _, err := pool.GetContext(context.Background()); err != ErrPoolExhausted {
+		t.Error("Expected ErrPoolExhausted", err)
+		t.FailNow()
+	}
+	if elapsed := time.Since(start); elapsed > 10*target {
+		t.Error("Expected Get to be rejected after the target", elapsed)
+		t.FailNow()
+	}
+
+	pool.Put(v)
+	v = <-a
+	if v != 1 {
+		t.Error("Expected first waiter to be served", v)
+		t.FailNow()
+	}
+
+	// short wait ends overload after the interval
+	d := wait()
+	time.Sleep(target / 5)
+	pool.Put(v)
+	if v = <-d; v != 1 {
+		t.Error("Expected quick waiter to be served", v)
+		t.FailNow()
+	}
+	time.Sleep(interval + target)
+
+	e := wait()
+	time.Sleep(2 * target)
+	pool.Put(v)
+	if v = <-e; v != 1 {
+		t.Error("Expected waiter not to be shed after overload", v)
+		t.FailNow()
+	}
+
+	if stats := pool.Stats(); stats.Shed != 1 {
+		t.Error("Expected one shed Get", stats.Shed)
+		t.FailNow()
+	}
+
+	pool.Put(v)
+	pool.Close(context.Background())
+}
+
+func TestBasicLimitedPool_Strict(t *testing.T) {
+	var (
+		released int
+		misused  []error
+	)
+
+	pool, err := New(func(context.Context) (*MyType, error) {
+		return &MyType{Value: 1}, nil
+	},
+		WithMaxOpen(2),
+		WithStrict(),
+		WithRelease(func(*MyType) { released++ }),
+		WithHooks(Hooks[*MyType]{
+			OnMisuse: func(item *MyType, err error) { misused = append(misused, err) },
+		}),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+	if debugBuild {
+		t.Skip("Strict mode panics in debug build")
+	}
+	raw := pool.(*limitedPool[*MyType])
+
+	v, _ := pool.Get()
+	pool.Put(v)
+	pool.Put(v)
+	pool.Put(&MyType{Value: 1})
+	pool.Discard(&MyType{Value: 1})
+
+	if len(misused) != 3 || misused[0] != ErrDoublePut || misused[1] != ErrForeignPut || misused[2] != ErrForeignPut {
+		t.Error("Expected misuse to be reported", misused)
+		t.FailNow()
+	}
+
+	if raw.current != 1 || raw.inuse != 0 || len(raw.idle) != 1 || released != 0 {
+		t.Error("Expected rejected items to be ignored", raw.current, raw.inuse, len(raw.idle), released)
+		t.FailNow()
+	}
+
+	pool.Close(context.Background())
+}
+
+func TestBasicLimitedPool_LeakDetection(t *testing.T) {
+	leaks := make(chan BorrowInfo, 4)
+	pool, err := New(func(context.Context) (*MyType, error) {
+		return &MyType{Value: 1}, nil
+	},
+		WithMaxOpen(2),
+		WithLeakDetection(50*time.Millisecond),
+		WithHooks(Hooks[*MyType]{
+			OnLeak: func(item *MyType, info BorrowInfo) { leaks <- info },
+		}),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	v, _ := pool.Get()
+	borrows := pool.Borrows()
+	if len(borrows) != 1 || borrows[0].Item != v || !strings.HasPrefix(borrows[0].Stack, poolPackage+"TestBasicLimitedPool_LeakDetection\n") {
+		t.Error("Expected borrower to be recorded", borrows)
+		t.FailNow()
+	}
+
+	select {
+	case info := <-leaks:
+		if info.Unreachable || info.Held < 50*time.Millisecond {
+			t.Error("Expected item held longer than threshold", info)
+			t.FailNow()
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected leak to be reported")
+		t.FailNow()
+	}
+
+	pool.Put(v)
+	if borrows := pool.Borrows(); len(borrows) != 0 {
+		t.Error("Expected returned item to be forgotten", borrows)
+		t.FailNow()
+	}
+
+	func() {
+		lease, err := pool.Acquire(context.Background())
+		if err != nil {
+			t.Error("Errror is not expected", err)
+			t.FailNow()
+		}
+		_ = lease.Value()
+	}()
+
+	deadline := time.After(time.Second)
+	for {
+		runtime.GC()
+		select {
+		case info := <-leaks:
+			if !info.Unreachable {
+				continue
+			}
+		case <-deadline:
+			t.Error("Expected unreachable lease to be reported")
+			t.FailNow()
+		case <-time.After(10 * time.Millisecond):
+			continue
+		}
+		break
+	}
+
+	lease, _ := pool.Acquire(context.Background())
+	lease.Release()
+	if borrows := pool.Borrows(); len(borrows) != 1 {
+		t.Error("Expected only leaked item to be outstanding", borrows)
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	pool.Close(ctx)
+}
+
+func TestBasicLimitedPool_RemoveAbandoned(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		next     int
+		released []int
+	)
+
+	pool, err := New(func(context.Context) (*MyType, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		next++
+		return &MyType{Value: next}, nil
+	},
+		WithMaxOpen(1),
+		WithRemoveAbandoned(100*time.Millisecond),
+		WithRelease(func(v *MyType) {
+			mu.Lock()
+			released = append(released, v.Value)
+			mu.Unlock()
+		}),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	v1, _ := pool.Get()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	v2, err := pool.GetContext(ctx)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+	if v2.Value != 2 {
+		t.Error("Expected new item in reclaimed slot", v2.Value)
+		t.FailNow()
+	}
+
+	raw := pool.(*limitedPool[*MyType])
+	raw.mu.Lock()
+	tracked := len(raw.borrowed)
+	raw.mu.Unlock()
+	if tracked != 1 {
+		t.Error("Expected reclaimed item to be forgotten", tracked)
+		t.FailNow()
+	}
+
+	pool.Put(v1)
+	stats := pool.Stats()
+	if stats.Open != 1 || stats.InUse != 1 || stats.Idle != 0 || stats.Abandoned != 1 {
+		t.Error("Expected abandoned item to be ignored", stats)
+		t.FailNow()
+	}
+	pool.Put(v2)
+
+	lease, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+	v3, err := pool.GetContext(ctx)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+	lease.Release()
+	stats = pool.Stats()
+	if stats.Open != 1 || stats.InUse != 1 || stats.Idle != 0 || stats.Abandoned != 2 {
+		t.Error("Expected stale lease to be ignored", stats)
+		t.FailNow()
+	}
+
+	mu.Lock()
+	if len(released) != 2 || released[0] != 1 || released[1] != 2 {
+		t.Error("Expected abandoned items to be released", released)
+	}
+	mu.Unlock()
+
+	pool.Put(v3)
+	pool.Close(context.Background())
+
+	if _, err := New(func(context.Context) (int, error) { return 0, nil }, WithRemoveAbandoned(time.Second)); !errors.Is(err, ErrorInvalidParameters) {
+		t.Error("Expected error for unlimited pool", err)
+	}
+}
+
+func TestBasicLimitedPool_IdleValidation(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		next   int
+		bad    int
+		checks = map[int]int{}
+	)
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	pool, err := New(func(context.Context) (*MyType, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		next++
+		return &MyType{Value: next}, nil
+	},
+		WithMaxOpen(3),
+		WithCheck(func(v *MyType) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			checks[v.Value]++
+			return v.Value != bad
+		}),
+		WithIdleValidation(100*time.Millisecond, 2),
+		WithSkipValidated(),
+		WithClock(clock),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	wait := func(done func(Stats) bool) Stats {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			stats := pool.Stats()
+			if done(stats) || time.Now().After(deadline) {
+				return stats
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	pool.SetMinIdle(2)
+	if stats := wait(func(s Stats) bool { return s.Idle == 2 }); stats.Idle != 2 {
+		t.Error("Expected idle items to be refilled", stats)
+		t.FailNow()
+	}
+
+	mu.Lock()
+	bad = 1
+	mu.Unlock()
+	clock.Add(100 * time.Millisecond)
+	if stats := wait(func(s Stats) bool { return s.CheckFailures == 1 && s.Idle == 2 }); stats.CheckFailures != 1 || stats.Idle != 2 {
+		t.Error("Expected failed idle item to be released and replaced", stats)
+		t.FailNow()
+	}
+
+	mu.Lock()
+	checked2, checked3 := checks[2], checks[3]
+	mu.Unlock()
+	v2, _ := pool.Get()
+	v3, _ := pool.Get()
+	mu.Lock()
+	if v2.Value != 2 || checks[2] != checked2 || v3.Value != 3 || checks[3] != checked3+1 {
+		t.Error("Expected check of validated item to be skipped", v2.Value, v3.Value, checks)
+	}
+	mu.Unlock()
+
+	pool.Put(v2)
+	pool.Put(v3)
+	pool.Close(context.Background())
+
+	if _, err := New(func(context.Context) (int, error) { return 0, nil }, WithIdleValidation(time.Second, 1)); !errors.Is(err, ErrorInvalidParameters) {
+		t.Error("Expected error without check", err)
+	}
+}
+
+func TestBasicLimitedPool_CloseBlockedRefill(t *testing.T) {
+	var (
+		started  = make(chan struct{}, 1)
+		block    = make(chan struct{})
+		released int32
+	)
+
+	pool, err := NewLimitedPool(0, 2, func() *MyType {
+		started <- struct{}{}
+		<-block
+		return &MyType{Value: 1}
+	}, func(*MyType) {
+		atomic.AddInt32(&released, 1)
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	pool.SetMinIdle(1)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	closed := make(chan error, 1)
+	go func() {
+		closed <- pool.Close(ctx)
+	}()
+
+	select {
+	case err := <-closed:
+		if !errors.Is(err, ErrWaitTimeout) {
+			t.Error("Expected wait timeout", err)
+			t.FailNow()
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected Close to return after ctx deadline")
+		t.FailNow()
+	}
+
+	close(block)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&released) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&released); n != 1 {
+		t.Error("Expected item created after close to be released", n)
+	}
+}
+
+func TestBasicLimitedPool_IdleValidationLIFO(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		next   int
+		checks = map[int]int{}
+	)
+	clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	pool, err := New(func(context.Context) (*MyType, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		next++
+		return &MyType{Value: next}, nil
+	},
+		WithMaxOpen(3),
+		WithIdleStrategy(IdleLIFO),
+		WithCheck(func(v *MyType) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			checks[v.Value]++
+			return true
+		}),
+		WithIdleValidation(100*time.Millisecond, 1),
+		WithClock(clock),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	v1, _ := pool.Get()
+	v2, _ := pool.Get()
+	v3, _ := pool.Get()
+	for _, v := range []*MyType{v1, v2, v3} {
+		clock.Add(time.Millisecond)
+		pool.Put(v)
+	}
+	clock.Add(100 * time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := checks[1]
+		mu.Unlock()
+		if n == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	v, _ := pool.Get()
+	mu.Lock()
+	if checks[1] != 1 || v.Value != 3 {
+		t.Error("Expected validated item to keep its place", v.Value, checks)
+	}
+	mu.Unlock()
+
+	pool.Put(v)
+	pool.Close(context.Background())
+}
+
+func TestBasicLimitedPool_ForeignPut(t *testing.T) {
+	var released int
+
+	pool, err := New(func(context.Context) (*MyType, error) {
+		return &MyType{Value: 1}, nil
+	},
+		WithMaxOpen(1),
+		WithRelease(func(*MyType) { released++ }),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	v, _ := pool.Get()
+	pool.Put(&MyType{Value: 2})
+	if _, ok := pool.TryGet(); ok {
+		t.Error("Expected foreign item not to take borrowed slot")
+		t.FailNow()
+	}
+	if stats := pool.Stats(); stats.Open != 1 || stats.InUse != 1 || released != 1 {
+		t.Error("Expected foreign item to be released", stats, released)
+		t.FailNow()
+	}
+
+	pool.Put(v)
+	pool.Put(v)
+	v1, _ := pool.TryGet()
+	if _, ok := pool.TryGet(); ok || v1 != v {
+		t.Error("Expected item returned twice to be idle once")
+		t.FailNow()
+	}
+
+	pool.Put(v1)
+	pool.Close(context.Background())
+}
+
+type holder struct {
+	V any
+}
+
+func TestBasicLimitedPool_UnhashableItems(t *testing.T) {
+	pool, err := NewLimitedPool(0, 2, func() holder { return holder{V: []byte("x")} }, nil, nil)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+	pool.SetHooks(Hooks[holder]{})
+
+	v, ok := pool.Get()
+	if !ok {
+		t.Error("Expected item")
+		t.FailNow()
+	}
+	pool.Put(v)
+	if stats := pool.Stats(); stats.Open != 1 || stats.Idle != 1 || stats.InUse != 0 {
+		t.Error("Expected item to be returned", stats)
+		t.FailNow()
+	}
+	pool.Close(context.Background())
+
+	if _, err := New(func(context.Context) ([]int, error) { return nil, nil }, WithMaxUses(1)); !errors.Is(err, ErrorInvalidParameters) {
+		t.Error("Expected error for items which are not comparable", err)
+		t.FailNow()
+	}
+	if _, err := New(func(context.Context) ([]int, error) { return nil, nil }, WithMaxLifetime(time.Second)); !errors.Is(err, ErrorInvalidParameters) {
+		t.Error("Expected error for items which are not comparable", err)
+		t.FailNow()
+	}
+}
+
+func TestBasicLimitedPool_QueueTargetPartialWait(t *testing.T) {
+	pool, err := New(func(context.Context) (int, error) { return 1, nil },
+		WithMaxOpen(1),
+		WithQueueTarget(50*time.Millisecond, time.Second),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+	raw := pool.(*limitedPool[int])
+
+	v, _ := pool.Get()
+	done := make(chan int, 1)
+	go func() {
+		v, _ := pool.Get()
+		done <- v
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// no capacity is freed, so waiter is not served
+	pool.(LimitedPool[int]).SetMaxOpen(1)
+	raw.mu.Lock()
+	seen := raw.shed.seen
+	raw.mu.Unlock()
+	if seen {
+		t.Error("Expected wait of waiter which is not served to be ignored")
+		t.FailNow()
+	}
+
+	pool.Put(v)
+	pool.Put(<-done)
+	pool.Close(context.Background())
+}
@@ -0,0 +1,492 @@
+package mpool
+
+import (
+	"context"
+	"time"
+)
+
+// defaultMaxIdle is idle limit of unlimited pool created without WithMaxIdle
+const defaultMaxIdle = 2
+
+// Clock provides current time to the pool, it is used for item ages, idle
+// and wait times, background cleaner still runs on real time
+type Clock interface {
+	Now() time.Time
+}
+
+// IdleStrategy selects which idle item is handed out by Get
+type IdleStrategy int
+
+const (
+	IdleFIFO   IdleStrategy = iota // The oldest idle item, items are worn evenly
+	IdleLIFO                       // The newest idle item, cold items expire with idle timeout
+	IdleRandom                     // Random idle item, load is spread across backends
+)
+
+func (s IdleStrategy) String() string {
+	switch s {
+	case IdleFIFO:
+		return "fifo"
+	case IdleLIFO:
+		return "lifo"
+	case IdleRandom:
+		return "random"
+	}
+	return "unknown"
+}
+
+// valid reports if strategy is known
+func (s IdleStrategy) valid() bool {
+	return s >= IdleFIFO && s <= IdleRandom
+}
+
+// Option configures pool created by New
+type Option interface {
+	apply(*config) error
+}
+
+type optionFunc func(*config) error
+
+func (f optionFunc) apply(c *config) error {
+	return f(c)
+}
+
+// config collects options, callbacks are kept untyped and checked by New
+type config struct {
+	maxOpen     uint
+	maxIdle     uint
+	maxIdleSet  bool
+	minIdle     uint
+	initial     uint
+	release     any // func(T)
+	check       any // func(T) bool
+	hooks       any // Hooks[T]
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+	maxUses     uint
+	strategy    IdleStrategy
+	aging       time.Duration
+	maxWaiters  uint
+	queueTarget time.Duration
+	interval    time.Duration
+	maxTotal    uint
+	keyed       bool // options are applied to keyed pool or to pool of one key
+	strict      bool
+	detect      bool
+	leakAfter   time.Duration
+	abandon     time.Duration
+	checkEvery  time.Duration
+	checkCount  uint
+	skipChecked bool
+	clock       Clock
+}
+
+// WithMaxOpen limits the number of live items, Get waits when the limit is
+// reached. Pool without the limit never waits.
+func WithMaxOpen(n uint) Option {
+	return optionFunc(func(c *config) error {
+		if n == 0 {
+			return &OptionError{Option: "WithMaxOpen", Reason: "must be positive"}
+		}
+		c.maxOpen = n
+		return nil
+	})
+}
+
+// WithMaxIdle limits the number of idle items, returned items above the
+// limit are released. Default is 2 for pool without WithMaxOpen and equal to
+// WithMaxOpen otherwise.
+func WithMaxIdle(n uint) Option {
+	return optionFunc(func(c *config) error {
+		c.maxIdle = n
+		c.maxIdleSet = true
+		return nil
+	})
+}
+
+// WithMinIdle creates n idle items when pool is created and keeps them ready
+// with background refill, see Pool.SetMinIdle
+func WithMinIdle(n uint) Option {
+	return optionFunc(func(c *config) error {
+		c.minIdle = n
+		return nil
+	})
+}
+
+// withInitial creates n idle items when pool is created, it backs positional
+// constructors
+func withInitial(n uint) Option {
+	return optionFunc(func(c *config) error {
+		c.initial = n
+		return nil
+	})
+}
+
+// WithRelease sets callback which releases item removed from the pool
+func WithRelease[T any](release func(T)) Option {
+	return optionFunc(func(c *config) error {
+		if release == nil {
+			return &OptionError{Option: "WithRelease", Reason: "must not be nil"}
+		}
+		c.release = release
+		return nil
+	})
+}
+
+// WithCheck sets callback which validates item before it is handed out
+func WithCheck[T any](check func(T) bool) Option {
+	return optionFunc(func(c *config) error {
+		if check == nil {
+			return &OptionError{Option: "WithCheck", Reason: "must not be nil"}
+		}
+		c.check = check
+		return nil
+	})
+}
+
+// WithHooks sets lifecycle hooks, see Pool.SetHooks
+func WithHooks[T any](hooks Hooks[T]) Option {
+	return optionFunc(func(c *config) error {
+		c.hooks = hooks
+		return nil
+	})
+}
+
+// WithIdleTimeout sets how long item may stay idle, see Pool.SetMaxIdleTime
+func WithIdleTimeout(d time.Duration) Option {
+	return optionFunc(func(c *config) error {
+		if d < 0 {
+			return &OptionError{Option: "WithIdleTimeout", Reason: "must not be negative"}
+		}
+		c.idleTimeout = d
+		return nil
+	})
+}
+
+// WithMaxLifetime sets how long item may be reused, see Pool.SetMaxLifetime.
+// New fails if items are not comparable.
+func WithMaxLifetime(d time.Duration) Option {
+	return optionFunc(func(c *config) error {
+		if d < 0 {
+			return &OptionError{Option: "WithMaxLifetime", Reason: "must not be negative"}
+		}
+		c.maxLifetime = d
+		return nil
+	})
+}
+
+// WithMaxUses sets how many times item may be handed out, see Pool.SetMaxUses.
+// New fails if items are not comparable.
+func WithMaxUses(n uint) Option {
+	return optionFunc(func(c *config) error {
+		c.maxUses = n
+		return nil
+	})
+}
+
+// WithIdleStrategy selects which idle item is handed out, default is IdleFIFO
+func WithIdleStrategy(s IdleStrategy) Option {
+	return optionFunc(func(c *config) error {
+		if !s.valid() {
+			return &OptionError{Option: "WithIdleStrategy", Reason: "unknown strategy " + s.String()}
+		}
+		c.strategy = s
+		return nil
+	})
+}
+
+// WithPriorityAging sets how long Get waits to be raised by one priority
+// class, so low priority callers are not starved, zero disables aging.
+// Default is one second.
+func WithPriorityAging(d time.Duration) Option {
+	return optionFunc(func(c *config) error {
+		if d < 0 {
+			return &OptionError{Option: "WithPriorityAging", Reason: "must not be negative"}
+		}
+		c.aging = d
+		return nil
+	})
+}
+
+// WithMaxWaiters limits how many Get calls may wait for limited pool, extra
+// calls fail with ErrPoolExhausted, zero means no limit
+func WithMaxWaiters(n uint) Option {
+	return optionFunc(func(c *config) error {
+		c.maxWaiters = n
+		return nil
+	})
+}
+
+// WithQueueTarget enables adaptive load shedding of limited pool: if even the
+// shortest wait during interval exceeded the target, new Get calls wait at
+// most the target and then fail with ErrPoolExhausted, until waits become
+// short again. Zero interval means 100ms.
+func WithQueueTarget(target, interval time.Duration) Option {
+	return optionFunc(func(c *config) error {
+		if target <= 0 {
+			return &OptionError{Option: "WithQueueTarget", Reason: "target must be positive"}
+		}
+		if interval < 0 {
+			return &OptionError{Option: "WithQueueTarget", Reason: "interval must not be negative"}
+		}
+		if interval == 0 {
+			interval = defaultShedInterval
+		}
+		c.queueTarget = target
+		c.interval = interval
+		return nil
+	})
+}
+
+// WithMaxTotal limits the number of live items of all keys of keyed pool,
+// idle items of other keys are released to make room
+func WithMaxTotal(n uint) Option {
+	return optionFunc(func(c *config) error {
+		c.maxTotal = n
+		return nil
+	})
+}
+
+// asKeyed marks options of pool of one key
+func asKeyed() Option {
+	return optionFunc(func(c *config) error {
+		c.keyed = true
+		return nil
+	})
+}
+
+// WithStrict makes Put and Discard reject items which are not borrowed: item
+// returned twice or item which was not taken from the pool. Rejected item is
+// not released and it is reported with Hooks.OnMisuse, debug build made with
+// mpooldebug tag panics. Items are matched by identity for pointers and by
+// value otherwise, items which are not comparable cannot be matched, so they
+// should be borrowed with Acquire.
+func WithStrict() Option {
+	return optionFunc(func(c *config) error {
+		c.strict = true
+		return nil
+	})
+}
+
+// WithLeakDetection records stack trace of every borrower, items held longer
+// than threshold and leases which become unreachable without Release are
+// reported with Hooks.OnLeak, zero threshold reports only unreachable leases.
+// Outstanding borrows are listed by Pool.Borrows. Items returned with Put
+// are matched only if they are comparable, other items should be borrowed
+// with Acquire. Held items are checked by background cleaner.
+func WithLeakDetection(threshold time.Duration) Option {
+	return optionFunc(func(c *config) error {
+		if threshold < 0 {
+			return &OptionError{Option: "WithLeakDetection", Reason: "must not be negative"}
+		}
+		c.detect = true
+		c.leakAfter = threshold
+		return nil
+	})
+}
+
+// WithRemoveAbandoned makes limited pool reclaim items borrowed longer than
+// timeout: the slot is freed for other Get calls and the item is released
+// while borrower may still use it. Later Put, Discard or Lease.Release of
+// reclaimed item is ignored and logged. Items returned with Put are matched
+// only if they are comparable, other items should be borrowed with Acquire.
+// Items are checked by background cleaner.
+func WithRemoveAbandoned(timeout time.Duration) Option {
+	return optionFunc(func(c *config) error {
+		if timeout <= 0 {
+			return &OptionError{Option: "WithRemoveAbandoned", Reason: "must be positive"}
+		}
+		c.abandon = timeout
+		return nil
+	})
+}
+
+// WithIdleValidation makes background cleaner check up to n idle items every
+// interval with WithCheck callback, items checked longest ago go first.
+// Failed items are released and replaced by refill if WithMinIdle is set.
+func WithIdleValidation(interval time.Duration, n uint) Option {
+	return optionFunc(func(c *config) error {
+		if interval <= 0 {
+			return &OptionError{Option: "WithIdleValidation", Reason: "interval must be positive"}
+		}
+		if n == 0 {
+			return &OptionError{Option: "WithIdleValidation", Reason: "n must be positive"}
+		}
+		c.checkEvery = interval
+		c.checkCount = n
+		return nil
+	})
+}
+
+// WithSkipValidated makes Get skip check of idle item validated by
+// WithIdleValidation within the last interval
+func WithSkipValidated() Option {
+	return optionFunc(func(c *config) error {
+		c.skipChecked = true
+		return nil
+	})
+}
+
+// WithClock replaces system clock, it is useful for tests
+func WithClock(clock Clock) Option {
+	return optionFunc(func(c *config) error {
+		if clock == nil {
+			return &OptionError{Option: "WithClock", Reason: "must not be nil"}
+		}
+		c.clock = clock
+		return nil
+	})
+}
+
+// New creates pool with factory, the pool is limited if WithMaxOpen is set.
+// Invalid options are reported with *OptionError.
+func New[T any](factory Factory[T], opts ...Option) (Pool[T], error) {
+	return newPool(context.Background(), factory, opts...)
+}
+
+// newPool creates pool, ctx is passed to factory during initial fill
+func newPool[T any](ctx context.Context, factory Factory[T], opts ...Option) (Pool[T], error) {
+	if factory == nil {
+		return nil, &OptionError{Option: "factory", Reason: "must not be nil"}
+	}
+	c := &config{aging: defaultPriorityAging}
+	for _, opt := range opts {
+		if err := opt.apply(c); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	if c.maxOpen > 0 {
+		return newLimitedPool(ctx, factory, c)
+	}
+	return newUnlimitedPool(ctx, factory, c)
+}
+
+// validate checks options against each other and sets defaults
+func (c *config) validate() error {
+	limit := "WithMaxIdle"
+	switch {
+	case c.maxOpen > 0 && !c.maxIdleSet:
+		c.maxIdle = c.maxOpen
+		limit = "WithMaxOpen"
+	case c.maxOpen > 0 && c.maxIdle > c.maxOpen:
+		return &OptionError{Option: "WithMaxIdle", Reason: "must not exceed WithMaxOpen"}
+	case !c.maxIdleSet:
+		c.maxIdle = defaultMaxIdle
+	}
+	if c.maxOpen == 0 && c.maxWaiters > 0 {
+		return &OptionError{Option: "WithMaxWaiters", Reason: "requires WithMaxOpen"}
+	}
+	if c.maxOpen == 0 && c.queueTarget > 0 {
+		return &OptionError{Option: "WithQueueTarget", Reason: "requires WithMaxOpen"}
+	}
+	if c.maxOpen == 0 && c.abandon > 0 {
+		return &OptionError{Option: "WithRemoveAbandoned", Reason: "requires WithMaxOpen"}
+	}
+	if c.checkEvery > 0 && c.check == nil {
+		return &OptionError{Option: "WithIdleValidation", Reason: "requires WithCheck"}
+	}
+	if c.skipChecked && c.checkEvery == 0 {
+		return &OptionError{Option: "WithSkipValidated", Reason: "requires WithIdleValidation"}
+	}
+	if c.maxTotal > 0 && !c.keyed {
+		return &OptionError{Option: "WithMaxTotal", Reason: "requires NewKeyed"}
+	}
+	if c.minIdle > c.maxIdle {
+		return &OptionError{Option: "WithMinIdle", Reason: "must not exceed " + limit}
+	}
+	return nil
+}
+
+// prefill returns how many items are created with the pool
+func (c *config) prefill() uint {
+	if c.initial > c.minIdle {
+		return c.initial
+	}
+	return c.minIdle
+}
+
+// positional converts arguments of positional constructors into options
+func positional[T any](initial uint, release func(T), check func(T) bool) []Option {
+	opts := []Option{withInitial(initial)}
+	if release != nil {
+		opts = append(opts, WithRelease(release))
+	}
+	if check != nil {
+		opts = append(opts, WithCheck(check))
+	}
+	return opts
+}
+
+// configure applies options to the pool before it is used
+func (pool *base[T]) configure(factory Factory[T], c *config) error {
+	pool.new = factory
+	if !comparableItems[T]() {
+		if c.maxLifetime > 0 {
+			return &OptionError{Option: "WithMaxLifetime", Reason: "requires comparable items"}
+		}
+		if c.maxUses > 0 {
+			return &OptionError{Option: "WithMaxUses", Reason: "requires comparable items"}
+		}
+	}
+	if c.release != nil {
+		release, ok := c.release.(func(T))
+		if !ok {
+			return &OptionError{Option: "WithRelease", Reason: "item type does not match pool"}
+		}
+		pool.release = release
+	}
+	if c.check != nil {
+		check, ok := c.check.(func(T) bool)
+		if !ok {
+			return &OptionError{Option: "WithCheck", Reason: "item type does not match pool"}
+		}
+		pool.check = check
+	}
+	if c.hooks != nil {
+		hooks, ok := c.hooks.(Hooks[T])
+		if !ok {
+			return &OptionError{Option: "WithHooks", Reason: "item type does not match pool"}
+		}
+		pool.SetHooks(hooks)
+	}
+	pool.clock = c.clock
+	pool.maxIdleTime = c.idleTimeout
+	pool.maxLifetime = c.maxLifetime
+	pool.maxUses = c.maxUses
+	pool.max = c.maxOpen
+	pool.strategy = c.strategy
+	pool.aging = c.aging
+	pool.strict = c.strict
+	pool.detect = c.detect
+	pool.leakThreshold = c.leakAfter
+	pool.abandonAfter = c.abandon
+	pool.validateEvery = c.checkEvery
+	pool.validateCount = c.checkCount
+	pool.skipValidated = c.skipChecked
+	pool.maxWaiters = c.maxWaiters
+	pool.shed = shedder{target: c.queueTarget, interval: c.interval}
+	pool.maxIdle = c.maxIdle
+	pool.idle = make([]*entry[T], 0, c.prefill())
+	return nil
+}
+
+// fill creates n idle items and starts background cleaner if it is needed
+func (pool *base[T]) fill(ctx context.Context, n uint) error {
+	for ; n > 0; n-- {
+		e, err := pool.spawn(ctx)
+		if err != nil {
+			return err
+		}
+		pool.mu.Lock()
+		pool.pushIdle(e)
+		pool.current++
+		pool.mu.Unlock()
+	}
+	pool.mu.Lock()
+	pool.startCleaner()
+	pool.mu.Unlock()
+	return nil
+}
@@ -1,12 +1,139 @@
 package mpool
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
 type Pool[T any] interface {
+	// Get returns item from the pool, waits for released item if needed
 	Get() (T, bool)
+	// GetContext returns item from the pool, waits for released item until ctx is done,
+	// waiters are served by priority set with ContextWithPriority
+	GetContext(ctx context.Context) (T, error)
+	// Acquire returns lease of item from the pool, waits for released item until ctx is done
+	Acquire(ctx context.Context) (*Lease[T], error)
+	// TryGet returns item from the pool without waiting, reports false if no item is available
+	TryGet() (T, bool)
+	// Put returns borrowed item to the pool
 	Put(T)
+	// Discard releases borrowed item instead of returning it to the pool
+	Discard(T)
+	// Close stops the pool and releases items, waits for borrowed items until ctx is done
+	Close(ctx context.Context) error
+	// SetMaxIdle sets how many idle items are kept
+	SetMaxIdle(n uint)
+	// SetMinIdle sets how many idle items are kept ready by background refill
+	SetMinIdle(n uint)
+	// SetIdleStrategy selects which idle item is handed out
+	SetIdleStrategy(s IdleStrategy)
+	// SetMaxIdleTime sets how long item may stay idle before it is released
+	SetMaxIdleTime(d time.Duration)
+	// SetMaxLifetime sets how long item may be reused since it was created
+	SetMaxLifetime(d time.Duration)
+	// SetMaxUses sets how many times item may be handed out before it is released
+	SetMaxUses(n uint)
+	// Stats returns pool statistics
+	Stats() Stats
+	// SetHooks sets lifecycle hooks
+	SetHooks(hooks Hooks[T])
+	// Borrows returns outstanding borrows recorded by leak detector
+	Borrows() []Borrow[T]
+}
+
+// Factory creates new item for the pool, ctx is the one passed to GetContext
+type Factory[T any] func(ctx context.Context) (T, error)
+
+// simpleFactory adapts factory which cannot fail
+func simpleFactory[T any](new func() T) Factory[T] {
+	return func(context.Context) (T, error) {
+		return new(), nil
+	}
 }
 
 var (
 	ErrorInvalidParameters = errors.New("Invalid Parameters")
+	ErrPoolClosed          = errors.New("Pool Closed")
+	ErrPoolExhausted       = errors.New("Pool Exhausted")
+	ErrFactoryFailed       = errors.New("Factory Failed")
+	ErrWaitTimeout         = errors.New("Wait Timeout")
+	ErrDoublePut           = errors.New("Double Put")
+	ErrForeignPut          = errors.New("Foreign Put")
 )
+
+// LimitedPool is pool created with the limit of live items
+type LimitedPool[T any] interface {
+	Pool[T]
+	// SetMaxOpen sets the limit of live items
+	SetMaxOpen(n uint)
+}
+
+// WaitError is returned by GetContext when ctx is done before item becomes
+// available, it matches ErrPoolExhausted with errors.Is if Get waited for
+// the pool limit and ErrWaitTimeout if ctx deadline is exceeded
+type WaitError struct {
+	Err       error
+	Exhausted bool // Get waited because the pool reached its limit
+}
+
+func (e *WaitError) Error() string {
+	return "Wait Interrupted: " + e.Err.Error()
+}
+
+func (e *WaitError) Unwrap() error {
+	return e.Err
+}
+
+func (e *WaitError) Is(target error) bool {
+	switch target {
+	case ErrPoolExhausted:
+		return e.Exhausted
+	case ErrWaitTimeout:
+		return errors.Is(e.Err, context.DeadlineExceeded)
+	}
+	return false
+}
+
+// passError is returned by internal factories for errors which are not
+// factory failures, they are passed to the caller as is
+type passError struct {
+	err error
+}
+
+func (e *passError) Error() string {
+	return e.err.Error()
+}
+
+// FactoryError wraps error returned by factory, it matches ErrFactoryFailed
+// with errors.Is
+type FactoryError struct {
+	Err error
+}
+
+func (e *FactoryError) Error() string {
+	return "Factory Failed: " + e.Err.Error()
+}
+
+func (e *FactoryError) Unwrap() error {
+	return e.Err
+}
+
+func (e *FactoryError) Is(target error) bool {
+	return target == ErrFactoryFailed
+}
+
+// OptionError is returned by New when option is invalid, it matches
+// ErrorInvalidParameters with errors.Is
+type OptionError struct {
+	Option string // Name of invalid option, e.g. "WithMaxIdle"
+	Reason string
+}
+
+func (e *OptionError) Error() string {
+	return "Invalid Parameters: " + e.Option + " " + e.Reason
+}
+
+func (e *OptionError) Unwrap() error {
+	return ErrorInvalidParameters
+}
@@ -0,0 +1,53 @@
+package mpool
+
+import (
+	"context"
+	"time"
+)
+
+// defaultPriorityAging is how long waiter waits to be raised by one priority
+// class when WithPriorityAging is not set
+const defaultPriorityAging = time.Second
+
+// Priority orders Get calls waiting for limited pool, higher priority is
+// served first
+type Priority int
+
+const (
+	PriorityLow    Priority = -1 // Bulk and batch work
+	PriorityNormal Priority = 0  // Default priority
+	PriorityHigh   Priority = 1  // Health checks and control requests
+)
+
+type priorityKey struct{}
+
+// ContextWithPriority returns ctx which makes GetContext wait with priority p
+func ContextWithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// priorityOf returns priority set with ContextWithPriority, PriorityNormal
+// by default
+func priorityOf(ctx context.Context) Priority {
+	p, ok := ctx.Value(priorityKey{}).(Priority)
+	if !ok {
+		return PriorityNormal
+	}
+	return p
+}
+
+// waiter is blocked Get call
+type waiter[T any] struct {
+	ready    chan *entry[T] // receives reserved item or slot, closed if pool is closed
+	priority Priority
+	since    time.Time
+}
+
+// rank returns priority raised by one class for every aging period waited,
+// aging zero disables raising
+func (w *waiter[T]) rank(now time.Time, aging time.Duration) Priority {
+	if aging <= 0 {
+		return w.priority
+	}
+	return w.priority + Priority(now.Sub(w.since)/aging)
+}
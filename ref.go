@@ -0,0 +1,20 @@
+//go:build go1.24
+
+package mpool
+
+import "weak"
+
+// poolRef refers to the pool from background goroutines without keeping it
+// alive, so pool which is not closed can be garbage collected
+type poolRef[T any] struct {
+	p weak.Pointer[base[T]]
+}
+
+func makeRef[T any](pool *base[T]) poolRef[T] {
+	return poolRef[T]{p: weak.Make(pool)}
+}
+
+// get returns the pool, nil if it is garbage collected
+func (r poolRef[T]) get() *base[T] {
+	return r.p.Value()
+}
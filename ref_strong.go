@@ -0,0 +1,19 @@
+//go:build !go1.24
+
+package mpool
+
+// poolRef refers to the pool from background goroutines, weak pointers are
+// not available before Go 1.24, so background goroutines keep the pool
+// alive until Close
+type poolRef[T any] struct {
+	p *base[T]
+}
+
+func makeRef[T any](pool *base[T]) poolRef[T] {
+	return poolRef[T]{p: pool}
+}
+
+// get returns the pool
+func (r poolRef[T]) get() *base[T] {
+	return r.p
+}
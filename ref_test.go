@@ -0,0 +1,41 @@
+//go:build go1.24
+
+package mpool
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBasicPool_FinalizedWithBackground(t *testing.T) {
+	var released int32
+
+	func() {
+		pool, err := New(func(context.Context) (*MyType, error) {
+			return &MyType{Value: 1}, nil
+		},
+			WithMaxOpen(2),
+			WithMinIdle(1),
+			WithIdleTimeout(time.Hour),
+			WithRelease(func(*MyType) { atomic.AddInt32(&released, 1) }),
+		)
+		if err != nil {
+			t.Error("Errror is not expected", err)
+			t.FailNow()
+		}
+		v, _ := pool.Get()
+		pool.Put(v)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&released) == 0 && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&released) == 0 {
+		t.Error("Expected pool with background goroutines to be finalized")
+	}
+}
@@ -0,0 +1,48 @@
+package mpool
+
+import "time"
+
+// defaultShedInterval is how long wait queue is watched before it is
+// considered overloaded when interval of WithQueueTarget is zero
+const defaultShedInterval = 100 * time.Millisecond
+
+// shedder detects standing wait queue as CoDel does: queue is overloaded if
+// the shortest wait during the last interval exceeded the target, then new
+// waiters wait at most the target
+type shedder struct {
+	target     time.Duration // zero disables shedding
+	interval   time.Duration
+	start      time.Time     // when current interval started
+	low        time.Duration // the shortest wait during current interval
+	seen       bool          // some wait was observed during current interval
+	overloaded bool
+}
+
+// observe records wait of served or rejected waiter
+func (s *shedder) observe(wait time.Duration) {
+	if !s.seen || wait < s.low {
+		s.low = wait
+		s.seen = true
+	}
+}
+
+// shedding reports if new waiter should wait at most the target, queued
+// tells if there are waiters
+func (s *shedder) shedding(now time.Time, queued bool) bool {
+	if s.target <= 0 {
+		return false
+	}
+	if s.start.IsZero() {
+		s.start = now
+	}
+	if now.Sub(s.start) >= s.interval {
+		if s.seen {
+			s.overloaded = s.low > s.target
+		} else {
+			// nobody was served during the whole interval
+			s.overloaded = queued
+		}
+		s.start, s.seen = now, false
+	}
+	return s.overloaded
+}
@@ -0,0 +1,83 @@
+package mpool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats contains pool statistics
+type Stats struct {
+	MaxOpen int // Maximum number of live items, 0 for unlimited pool
+	MaxIdle int // Maximum number of idle items
+
+	// Pool status
+	Open  int // The number of live items: idle and borrowed
+	InUse int // The number of borrowed items
+	Idle  int // The number of idle items
+
+	// Counters
+	WaitCount         int64         // The total number of Get calls waited for an item
+	WaitDuration      time.Duration // The total time blocked waiting for an item
+	Created           int64         // The total number of created items
+	Released          int64         // The total number of released items
+	CheckFailures     int64         // The total number of items failed check
+	MaxIdleClosed     int64         // The total number of items released due to idle limit
+	MaxIdleTimeClosed int64         // The total number of items released due to SetMaxIdleTime
+	MaxLifetimeClosed int64         // The total number of items released due to SetMaxLifetime
+	MaxUsesClosed     int64         // The total number of items released due to SetMaxUses
+	Shed              int64         // The total number of Get calls rejected by WithMaxWaiters or WithQueueTarget
+	Abandoned         int64         // The total number of borrowed items reclaimed due to WithRemoveAbandoned
+}
+
+// counters are updated atomically and do not need pool lock,
+// they must stay first in the struct to be aligned on 32-bit platforms
+type counters struct {
+	waitCount         int64
+	waitDuration      int64
+	created           int64
+	released          int64
+	checkFailures     int64
+	maxIdleClosed     int64
+	maxIdleTimeClosed int64
+	maxLifetimeClosed int64
+	maxUsesClosed     int64
+	shed              int64
+	abandoned         int64
+}
+
+func (c *counters) waited(d time.Duration) {
+	atomic.AddInt64(&c.waitCount, 1)
+	atomic.AddInt64(&c.waitDuration, int64(d))
+}
+
+// destroyed counts released items
+func (c *counters) destroyed(reason DestroyReason, n int) {
+	atomic.AddInt64(&c.released, int64(n))
+	switch reason {
+	case DestroyIdleFull:
+		atomic.AddInt64(&c.maxIdleClosed, int64(n))
+	case DestroyIdleTimeout:
+		atomic.AddInt64(&c.maxIdleTimeClosed, int64(n))
+	case DestroyLifetime:
+		atomic.AddInt64(&c.maxLifetimeClosed, int64(n))
+	case DestroyMaxUses:
+		atomic.AddInt64(&c.maxUsesClosed, int64(n))
+	case DestroyAbandoned:
+		atomic.AddInt64(&c.abandoned, int64(n))
+	}
+}
+
+// fill copies counters into stats
+func (c *counters) fill(stats *Stats) {
+	stats.WaitCount = atomic.LoadInt64(&c.waitCount)
+	stats.WaitDuration = time.Duration(atomic.LoadInt64(&c.waitDuration))
+	stats.Created = atomic.LoadInt64(&c.created)
+	stats.Released = atomic.LoadInt64(&c.released)
+	stats.CheckFailures = atomic.LoadInt64(&c.checkFailures)
+	stats.MaxIdleClosed = atomic.LoadInt64(&c.maxIdleClosed)
+	stats.MaxIdleTimeClosed = atomic.LoadInt64(&c.maxIdleTimeClosed)
+	stats.MaxLifetimeClosed = atomic.LoadInt64(&c.maxLifetimeClosed)
+	stats.MaxUsesClosed = atomic.LoadInt64(&c.maxUsesClosed)
+	stats.Shed = atomic.LoadInt64(&c.shed)
+	stats.Abandoned = atomic.LoadInt64(&c.abandoned)
+}
@@ -1,90 +1,268 @@
 package mpool
 
 import (
+	"context"
+	"log"
 	"runtime"
-	"sync"
 )
 
 // Pool provides generic unlimited pool
 type unlimitedPool[T any] struct {
-	new     func() T
-	release func(T)
-	check   func(T) bool
-	queue   chan T
-	mu      sync.Mutex
+	base[T]
 }
 
 func NewPool[T any](initial, max uint, new func() T, release func(T), check func(T) bool) (Pool[T], error) {
-	if initial > max || new == nil {
+	if new == nil {
 		return nil, ErrorInvalidParameters
 	}
+	return NewPoolWithFactory(context.Background(), initial, max, simpleFactory(new), release, check)
+}
 
-	pool := &unlimitedPool[T]{
-		queue:   make(chan T, max),
-		new:     new,
-		release: release,
-		check:   check,
+// NewPoolWithFactory creates unlimited pool with factory which can fail,
+// ctx is passed to factory during initial fill
+func NewPoolWithFactory[T any](ctx context.Context, initial, max uint, factory Factory[T], release func(T), check func(T) bool) (Pool[T], error) {
+	if initial > max || factory == nil {
+		return nil, ErrorInvalidParameters
 	}
+	return newPool(ctx, factory, append(positional(initial, release, check), WithMaxIdle(max))...)
+}
+
+// newUnlimitedPool creates pool with validated options
+func newUnlimitedPool[T any](ctx context.Context, factory Factory[T], c *config) (Pool[T], error) {
+	pool := &unlimitedPool[T]{}
+	if err := pool.configure(factory, c); err != nil {
+		return nil, err
+	}
+	if err := pool.fill(ctx, c.prefill()); err != nil {
+		pool.destroy(context.Background())
+		return nil, err
+	}
+	pool.SetMinIdle(c.minIdle)
 
 	runtime.SetFinalizer(pool, func(v *unlimitedPool[T]) {
-		v.destroy()
+		if !v.isClosed() {
+			log.Println("mpool: pool is garbage collected without Close")
+			v.destroy(context.Background())
+		}
 	})
 
-	for ; initial > 0; initial-- {
-		pool.queue <- pool.new()
-	}
-
 	return pool, nil
 }
 
 func (pool *unlimitedPool[T]) Get() (T, bool) {
-	if pool.queue == nil {
-		// pool aleardy destroyed, return nothing
+	item, err := pool.GetContext(context.Background())
+	return item, err == nil
+}
+
+func (pool *unlimitedPool[T]) GetContext(ctx context.Context) (T, error) {
+	e, err := pool.acquire(ctx, true)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	pool.lend(e, 0)
+	return e.value, nil
+}
+
+// Acquire returns lease of item from the pool
+func (pool *unlimitedPool[T]) Acquire(ctx context.Context) (*Lease[T], error) {
+	e, err := pool.acquire(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	pool.lend(e, 0)
+	l := newLease[T](pool, e, 0)
+	pool.watchLease(l)
+	return l, nil
+}
+
+// TryGet returns idle item, it never creates new one
+func (pool *unlimitedPool[T]) TryGet() (T, bool) {
+	e, err := pool.acquire(context.Background(), false)
+	if err != nil {
 		var zero T
 		return zero, false
 	}
+	pool.lend(e, 0)
+	return e.value, true
+}
+
+// acquire takes valid idle item, creates new one if there is no valid idle
+// item and create is set, otherwise fails with ErrPoolExhausted
+func (pool *unlimitedPool[T]) acquire(ctx context.Context, create bool) (*entry[T], error) {
+	pool.mu.Lock()
+	if pool.closed {
+		pool.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
 
-	for {
-		select {
-		case item := <-pool.queue:
-			if pool.check != nil && pool.check(item) == false {
-				if pool.release != nil {
-					pool.release(item)
-				}
-				item = pool.new()
-			}
-			return item, true
-		default:
-			return pool.new(), true
+	if err := ctx.Err(); err != nil {
+		pool.mu.Unlock()
+		return nil, &WaitError{Err: err}
+	}
+
+	pool.inuse++
+	for attempts := 0; attempts < maxCheckAttempts; {
+		e, ok := pool.popIdle()
+		if !ok {
+			break
+		}
+		if reason, ok := pool.expired(e, pool.now()); ok {
+			pool.current--
+			pool.mu.Unlock()
+			pool.drop(reason, e)
+			pool.mu.Lock()
+			continue
+		}
+		pool.track(e)
+		pool.mu.Unlock()
+		if pool.checked(e) || pool.valid(e) {
+			return e, nil
 		}
+		pool.drop(DestroyCheckFailed, e)
+		attempts++
+		pool.mu.Lock()
+		pool.untrackEntry(e)
+		pool.current--
 	}
+	if !create {
+		pool.giveback()
+		pool.mu.Unlock()
+		return nil, ErrPoolExhausted
+	}
+	pool.current++
+	pool.mu.Unlock()
+	return pool.create(ctx)
+}
+
+// create makes new item for borrower
+func (pool *unlimitedPool[T]) create(ctx context.Context) (*entry[T], error) {
+	e, err := pool.spawn(ctx)
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if err != nil {
+		pool.giveback()
+		pool.current--
+		return nil, err
+	}
+	pool.track(e)
+	return e, nil
 }
 
 func (pool *unlimitedPool[T]) Put(item T) {
-	select {
-	case pool.queue <- item:
+	pool.mu.Lock()
+	e, borrowed, err := pool.receive(item)
+	if err != nil {
+		pool.mu.Unlock()
+		pool.misuse(item, err)
 		return
-	default:
-		// pool is full or destroyed, destroy item
-		if pool.release != nil {
-			pool.release(item)
+	}
+	pool.returned(e)
+	pool.restore(e, borrowed)
+}
+
+// putEntry returns leased item to the pool
+func (pool *unlimitedPool[T]) putEntry(e *entry[T]) {
+	pool.mu.Lock()
+	if !pool.receiveEntry(e) {
+		return
+	}
+	pool.returned(e)
+	pool.restore(e, true)
+}
+
+// restore keeps returned item in the pool or releases it, borrowed is false
+// for foreign item. It must be called with mu held and it releases mu.
+func (pool *unlimitedPool[T]) restore(e *entry[T], borrowed bool) {
+	if borrowed {
+		pool.giveback()
+	}
+	reason, expired := pool.outlived(e, pool.now())
+	if !pool.closed && uint(len(pool.idle)) < pool.maxIdle && !expired {
+		if !borrowed {
+			pool.current++
 		}
+		pool.pushIdle(e)
+		pool.mu.Unlock()
 		return
 	}
+	if borrowed {
+		pool.current--
+	}
+	if pool.closed {
+		reason = DestroyClosed
+	} else if !expired {
+		reason = DestroyIdleFull
+	}
+	pool.mu.Unlock()
+
+	pool.drop(reason, e)
 }
 
-func (pool *unlimitedPool[T]) destroy() {
+// Discard releases borrowed item instead of returning it to the pool,
+// it should be used for broken items
+func (pool *unlimitedPool[T]) Discard(item T) {
 	pool.mu.Lock()
-	defer pool.mu.Unlock()
-	if pool.queue == nil {
-		// pool is aleardy destroyed
+	e, borrowed, err := pool.receive(item)
+	if err != nil {
+		pool.mu.Unlock()
+		pool.misuse(item, err)
 		return
 	}
-	close(pool.queue)
-	for item := range pool.queue {
-		if pool.release != nil {
-			pool.release(item)
-		}
+	pool.discard(e, borrowed)
+}
+
+// discardEntry releases leased item
+func (pool *unlimitedPool[T]) discardEntry(e *entry[T]) {
+	pool.mu.Lock()
+	if !pool.receiveEntry(e) {
+		return
 	}
-	pool.queue = nil
+	pool.discard(e, true)
+}
+
+// discard releases item and frees its slot if item was borrowed, it must be
+// called with mu held and it releases mu
+func (pool *unlimitedPool[T]) discard(e *entry[T], borrowed bool) {
+	if borrowed {
+		pool.giveback()
+		pool.current--
+	}
+	pool.mu.Unlock()
+
+	pool.drop(DestroyDiscarded, e)
+}
+
+// Close stops the pool: new Get calls fail with ErrPoolClosed, borrowed items
+// are released on Put. Close waits until all borrowed items are returned or
+// ctx is done, and then releases idle items.
+func (pool *unlimitedPool[T]) Close(ctx context.Context) error {
+	pool.mu.Lock()
+	drained, ok := pool.markClosed()
+	pool.mu.Unlock()
+	if !ok {
+		return ErrPoolClosed
+	}
+
+	err := pool.waitDrained(ctx, drained)
+	if derr := pool.destroy(ctx); err == nil {
+		err = derr
+	}
+	return err
+}
+
+// destroy closes the pool and releases idle items, it waits for background
+// refill until ctx is done
+func (pool *unlimitedPool[T]) destroy(ctx context.Context) error {
+	pool.mu.Lock()
+	pool.markClosed()
+	pool.mu.Unlock()
+	err := pool.waitFiller(ctx)
+
+	pool.mu.Lock()
+	entries := pool.takeIdle()
+	pool.mu.Unlock()
+
+	pool.drop(DestroyClosed, entries...)
+	return err
 }
@@ -1,20 +1,28 @@
 package mpool
 
 import (
+	"context"
+	"errors"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type MyType struct {
 	Value int
 }
 
-func TestBasicUnlimitedPool_NoQueue(t *testing.T) {
+func TestBasicUnlimitedPool_Destroyed(t *testing.T) {
 	pool := &unlimitedPool[*MyType]{}
 
-	pool.new = func() *MyType {
+	pool.new = simpleFactory(func() *MyType {
 		return &MyType{}
-	}
+	})
+
+	pool.destroy(context.Background())
 
 	v, _ := pool.Get()
 	if v != nil {
@@ -28,27 +36,25 @@ func TestBasicUnlimitedPool_NoQueue(t *testing.T) {
 		t.Error("Expected nil")
 		t.FailNow()
 	}
-
-	pool.destroy()
 }
 
 func TestBasicUnlimitedPool_OneItemQueue(t *testing.T) {
 	pool := &unlimitedPool[*MyType]{}
 
-	pool.new = func() *MyType {
+	pool.new = simpleFactory(func() *MyType {
 		return &MyType{Value: 1}
-	}
+	})
 
-	pool.queue = make(chan *MyType, 1)
+	pool.maxIdle = 1
 
 	if v, _ := pool.Get(); v.Value != 1 {
 		t.Error("Expected 1")
 		t.FailNow()
 	}
 
-	pool.new = func() *MyType {
+	pool.new = simpleFactory(func() *MyType {
 		return &MyType{Value: 2}
-	}
+	})
 	pool.Put(&MyType{Value: 1})
 
 	if v, _ := pool.Get(); v.Value != 1 {
@@ -66,10 +72,10 @@ func TestBasicUnlimitedPool_Callbacks(t *testing.T) {
 		flagcheckcalled   bool
 	)
 
-	pool.new = func() *MyType {
+	pool.new = simpleFactory(func() *MyType {
 		flagnewcalled = true
 		return &MyType{Value: 1}
-	}
+	})
 
 	pool.check = func(v *MyType) bool {
 		flagcheckcalled = true
@@ -88,7 +94,7 @@ func TestBasicUnlimitedPool_Callbacks(t *testing.T) {
 		}
 	}
 
-	pool.queue = make(chan *MyType, 1)
+	pool.maxIdle = 1
 
 	if v, _ := pool.Get(); v.Value != 1 {
 		t.Error("Expected 1")
@@ -112,10 +118,10 @@ func TestBasicUnlimitedPool_Callbacks(t *testing.T) {
 
 	flagnewcalled = false
 
-	pool.new = func() *MyType {
+	pool.new = simpleFactory(func() *MyType {
 		flagnewcalled = true
 		return &MyType{Value: 2}
-	}
+	})
 	pool.Put(&MyType{Value: 1})
 
 	if flagnewcalled {
@@ -176,10 +182,10 @@ func TestBasicUnlimitedPool_Callbacks(t *testing.T) {
 	flagcheckcalled = false
 	flagreleasecalled = false
 
-	pool.new = func() *MyType {
+	pool.new = simpleFactory(func() *MyType {
 		flagnewcalled = true
 		return &MyType{Value: 3}
-	}
+	})
 
 	pool.check = func(v *MyType) bool {
 		flagcheckcalled = true
@@ -457,3 +463,594 @@ func TestBasicUnlimitedPool_APIError(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestBasicUnlimitedPool_GetContext(t *testing.T) {
+	pool, err := NewPool(1, 1, func() int { return 1 }, nil, nil)
+
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	if v, err := pool.GetContext(context.Background()); err != nil || v != 1 {
+		t.Error("Expected 1 without error")
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := pool.GetContext(ctx); !errors.Is(err, context.Canceled) || errors.Is(err, ErrPoolExhausted) {
+		t.Error("Expected Canceled", err)
+		t.FailNow()
+	}
+}
+
+func TestBasicUnlimitedPool_Close(t *testing.T) {
+	var released int32
+
+	pool, err := NewPool(1, 1, func() int { return 1 }, func(int) {
+		atomic.AddInt32(&released, 1)
+	}, nil)
+
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	v, _ := pool.Get()
+
+	closed := make(chan error)
+	go func() {
+		closed <- pool.Close(context.Background())
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := pool.GetContext(context.Background()); err != ErrPoolClosed {
+		t.Error("Expected ErrPoolClosed", err)
+		t.FailNow()
+	}
+
+	pool.Put(v)
+	if err := <-closed; err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	if atomic.LoadInt32(&released) != 1 {
+		t.Error("Expected 1 released item", released)
+		t.FailNow()
+	}
+
+	pool.Put(v)
+	if atomic.LoadInt32(&released) != 2 {
+		t.Error("Expected 2 released items", released)
+		t.FailNow()
+	}
+}
+
+func TestBasicUnlimitedPool_FactoryError(t *testing.T) {
+	errFactory := errors.New("factory failed")
+	var (
+		created  int
+		released int
+	)
+
+	factory := func(ctx context.Context) (int, error) {
+		if created == 1 {
+			return 0, errFactory
+		}
+		created++
+		return 1, nil
+	}
+
+	_, err := NewPoolWithFactory(context.Background(), 2, 2, factory, func(int) {
+		released++
+	}, nil)
+	if !errors.Is(err, errFactory) || !errors.Is(err, ErrFactoryFailed) {
+		t.Error("Expected factory error", err)
+		t.FailNow()
+	}
+
+	if released != 1 {
+		t.Error("Expected created item to be released", released)
+		t.FailNow()
+	}
+
+	created = 0
+	pool, err := NewPoolWithFactory(context.Background(), 0, 1, factory, nil, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	if _, err := pool.GetContext(context.Background()); err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	if _, ok := pool.Get(); ok {
+		t.Error("Expected false")
+		t.FailNow()
+	}
+
+	if _, err := pool.GetContext(context.Background()); !errors.Is(err, errFactory) {
+		t.Error("Expected factory error", err)
+		t.FailNow()
+	}
+}
+
+func TestBasicUnlimitedPool_Discard(t *testing.T) {
+	var released int
+
+	pool, err := NewPool(0, 1, func() int { return 1 }, func(int) {
+		released++
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*unlimitedPool[int])
+
+	v, _ := pool.Get()
+	pool.Discard(v)
+
+	if raw.inuse != 0 || len(raw.idle) != 0 {
+		t.Error("Expected item to be dropped", raw.inuse, len(raw.idle))
+		t.FailNow()
+	}
+
+	if released != 1 {
+		t.Error("Expected discarded item to be released", released)
+		t.FailNow()
+	}
+}
+
+func TestBasicUnlimitedPool_ConcurrentClose(t *testing.T) {
+	const workers = 16
+
+	var created, released int32
+
+	pool, err := NewPool(2, 4, func() int {
+		atomic.AddInt32(&created, 1)
+		return 1
+	}, func(int) {
+		atomic.AddInt32(&released, 1)
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				v, err := pool.GetContext(context.Background())
+				if err == ErrPoolClosed {
+					return
+				}
+				if err != nil {
+					t.Error("Unexpected error", err)
+					return
+				}
+				if (w+i)%5 == 0 {
+					pool.Discard(v)
+				} else {
+					pool.Put(v)
+				}
+			}
+		}(w)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if err := pool.Close(context.Background()); err != nil {
+		t.Error("Errror is not expected", err)
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&created) != atomic.LoadInt32(&released) {
+		t.Error("Expected all items to be released", created, released)
+		t.FailNow()
+	}
+
+	pool.Put(1)
+	if atomic.LoadInt32(&released) != atomic.LoadInt32(&created)+1 {
+		t.Error("Expected item to be released after Close")
+		t.FailNow()
+	}
+}
+
+func TestBasicUnlimitedPool_CheckAttempts(t *testing.T) {
+	var checks, released int
+
+	value := 0
+	pool, err := NewPool(5, 5, func() int {
+		value++
+		return value
+	}, func(int) {
+		released++
+	}, func(int) bool {
+		checks++
+		return false
+	})
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*unlimitedPool[int])
+
+	if v, _ := pool.Get(); v != 6 {
+		t.Error("Expected new item", v)
+		t.FailNow()
+	}
+
+	if checks != maxCheckAttempts || released != maxCheckAttempts {
+		t.Error("Expected bounded number of checks", checks, released)
+		t.FailNow()
+	}
+
+	if len(raw.idle) != 2 {
+		t.Error("Expected 2 idle items", len(raw.idle))
+		t.FailNow()
+	}
+}
+
+func TestBasicUnlimitedPool_MaxIdleTime(t *testing.T) {
+	var released int32
+
+	pool, err := NewPool(2, 2, func() int { return 1 }, func(int) {
+		atomic.AddInt32(&released, 1)
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*unlimitedPool[int])
+
+	pool.SetMaxIdleTime(10 * time.Millisecond)
+	time.Sleep(3 * minCleanInterval)
+
+	raw.mu.Lock()
+	current, idle := raw.current, len(raw.idle)
+	raw.mu.Unlock()
+	if current != 0 || idle != 0 || atomic.LoadInt32(&released) != 2 {
+		t.Error("Expected stale items to be released by cleaner", current, idle, released)
+		t.FailNow()
+	}
+
+	pool.SetMaxIdleTime(0)
+	pool.Put(1)
+	time.Sleep(minCleanInterval)
+	if atomic.LoadInt32(&released) != 2 {
+		t.Error("Expected item to be kept", released)
+		t.FailNow()
+	}
+
+	pool.Close(context.Background())
+}
+
+func TestBasicUnlimitedPool_MaxUses(t *testing.T) {
+	var released int
+
+	pool, err := NewPool(0, 1, func() *MyType {
+		return &MyType{Value: 1}
+	}, func(*MyType) {
+		released++
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	pool.SetMaxUses(3)
+
+	v1, _ := pool.Get()
+	pool.Put(v1)
+	v2, _ := pool.Get()
+	pool.Put(v2)
+	v3, _ := pool.Get()
+	pool.Put(v3)
+
+	if v1 != v2 || v2 != v3 || released != 1 {
+		t.Error("Expected item to be reused 3 times", released)
+		t.FailNow()
+	}
+
+	if v4, _ := pool.Get(); v4 == v1 {
+		t.Error("Expected new item")
+		t.FailNow()
+	}
+}
+
+func TestBasicUnlimitedPool_Stats(t *testing.T) {
+	pool, err := NewPool(0, 1, func() int { return 1 }, nil, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	v1, _ := pool.Get()
+	v2, _ := pool.Get()
+
+	stats := pool.Stats()
+	if stats.MaxOpen != 0 || stats.Open != 2 || stats.InUse != 2 || stats.Created != 2 {
+		t.Error("Unexpected stats", stats)
+		t.FailNow()
+	}
+
+	pool.Put(v1)
+	pool.Put(v2)
+
+	stats = pool.Stats()
+	if stats.Open != 1 || stats.Idle != 1 || stats.InUse != 0 || stats.MaxIdleClosed != 1 || stats.Released != 1 {
+		t.Error("Unexpected stats", stats)
+		t.FailNow()
+	}
+
+	pool.SetMaxLifetime(time.Nanosecond)
+	stats = pool.Stats()
+	if stats.Open != 0 || stats.Idle != 0 || stats.MaxLifetimeClosed != 1 || stats.Released != 2 {
+		t.Error("Unexpected stats", stats)
+		t.FailNow()
+	}
+
+	pool.Close(context.Background())
+}
+
+func TestBasicUnlimitedPool_Hooks(t *testing.T) {
+	var destroyed []string
+
+	pool, err := NewPool(0, 1, func() int { return 1 }, nil, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	pool.SetHooks(Hooks[int]{
+		OnDestroy: func(v int, info ItemInfo, reason DestroyReason) {
+			destroyed = append(destroyed, reason.String())
+		},
+	})
+
+	v1, _ := pool.Get()
+	v2, _ := pool.Get()
+	pool.Put(v1)
+	pool.Put(v2)
+	pool.SetMaxUses(1)
+	pool.Close(context.Background())
+	pool.Put(1)
+
+	expected := []string{"idle full", "max uses", "closed"}
+	if len(destroyed) != len(expected) {
+		t.Error("Unexpected destroy reasons", destroyed)
+		t.FailNow()
+	}
+	for i := range expected {
+		if destroyed[i] != expected[i] {
+			t.Error("Unexpected destroy reasons", destroyed)
+			t.FailNow()
+		}
+	}
+}
+
+func TestBasicUnlimitedPool_New(t *testing.T) {
+	factory := func(context.Context) (int, error) { return 1, nil }
+
+	pool, err := New(factory)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+	raw, ok := pool.(*unlimitedPool[int])
+	if !ok || raw.maxIdle != defaultMaxIdle {
+		t.Error("Expected unlimited pool with default idle limit")
+		t.FailNow()
+	}
+	pool.Close(context.Background())
+
+	tests := []struct {
+		option string
+		opts   []Option
+	}{
+		{"factory", nil},
+		{"WithMaxOpen", []Option{WithMaxOpen(0)}},
+		{"WithMinIdle", []Option{WithMaxIdle(1), WithMinIdle(2)}},
+		{"WithIdleTimeout", []Option{WithIdleTimeout(-time.Second)}},
+		{"WithRelease", []Option{WithRelease(func(string) {})}},
+		{"WithCheck", []Option{WithCheck[int](nil)}},
+		{"WithClock", []Option{WithClock(nil)}},
+	}
+	for _, test := range tests {
+		f := factory
+		if test.option == "factory" {
+			f = nil
+		}
+		_, err := New(f, test.opts...)
+		var optErr *OptionError
+		if !errors.As(err, &optErr) || optErr.Option != test.option {
+			t.Error("Expected option error", test.option, err)
+			t.FailNow()
+		}
+		if !errors.Is(err, ErrorInvalidParameters) {
+			t.Error("Expected ErrorInvalidParameters", err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestBasicUnlimitedPool_TryGet(t *testing.T) {
+	var created int
+
+	pool, err := NewPool(0, 1, func() int {
+		created++
+		return created
+	}, nil, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*unlimitedPool[int])
+
+	if _, ok := pool.TryGet(); ok {
+		t.Error("Expected false without idle items")
+		t.FailNow()
+	}
+
+	if created != 0 || raw.current != 0 || raw.inuse != 0 {
+		t.Error("Expected no item to be created", created, raw.current, raw.inuse)
+		t.FailNow()
+	}
+
+	pool.Put(5)
+	if v, ok := pool.TryGet(); !ok || v != 5 {
+		t.Error("Expected idle item", v)
+		t.FailNow()
+	}
+
+	if raw.current != 1 || raw.inuse != 1 {
+		t.Error("Expected item to be borrowed", raw.current, raw.inuse)
+		t.FailNow()
+	}
+}
+
+func TestBasicUnlimitedPool_SetMaxIdle(t *testing.T) {
+	var released int
+
+	pool, err := NewPool(3, 3, func() int { return 1 }, func(int) {
+		released++
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	pool.SetMaxIdle(1)
+	if stats := pool.Stats(); stats.Idle != 1 || stats.Open != 1 || stats.MaxIdle != 1 || released != 2 {
+		t.Error("Expected idle items above the limit to be released", stats, released)
+		t.FailNow()
+	}
+
+	pool.Put(1)
+	if released != 3 {
+		t.Error("Expected returned item to be released", released)
+		t.FailNow()
+	}
+}
+
+func TestBasicUnlimitedPool_MinIdle(t *testing.T) {
+	var released int32
+
+	pool, err := NewPool(0, 2, func() int { return 1 }, func(int) {
+		atomic.AddInt32(&released, 1)
+	}, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+	raw := pool.(*unlimitedPool[int])
+
+	pool.SetMinIdle(3)
+	time.Sleep(50 * time.Millisecond)
+	if stats := pool.Stats(); stats.Idle != 2 {
+		t.Error("Expected refill to respect MaxIdle", stats.Idle)
+		t.FailNow()
+	}
+
+	pool.Close(context.Background())
+	raw.mu.Lock()
+	filler := raw.filler
+	raw.mu.Unlock()
+	if filler != nil || atomic.LoadInt32(&released) != 2 {
+		t.Error("Expected refill to stop and items to be released", released)
+		t.FailNow()
+	}
+}
+
+func TestBasicUnlimitedPool_IdleStrategy(t *testing.T) {
+	pool, err := NewPool(0, 2, func() int { return 0 }, nil, nil)
+	if err != nil {
+		t.Error("Errror is not expected")
+		t.FailNow()
+	}
+
+	pool.SetIdleStrategy(IdleLIFO)
+	pool.Put(1)
+	pool.Put(2)
+	if v, _ := pool.Get(); v != 2 {
+		t.Error("Expected the newest item", v)
+		t.FailNow()
+	}
+
+	pool.SetIdleStrategy(IdleStrategy(10))
+	pool.Put(3)
+	if v, _ := pool.Get(); v != 3 {
+		t.Error("Expected unknown strategy to be ignored", v)
+		t.FailNow()
+	}
+}
+
+func TestBasicUnlimitedPool_Strict(t *testing.T) {
+	var misused []error
+
+	pool, err := New(func(context.Context) (int, error) { return 1, nil },
+		WithStrict(),
+		WithHooks(Hooks[int]{
+			OnMisuse: func(item int, err error) { misused = append(misused, err) },
+		}),
+	)
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+	if debugBuild {
+		t.Skip("Strict mode panics in debug build")
+	}
+	raw := pool.(*unlimitedPool[int])
+
+	v1, _ := pool.Get()
+	v2, _ := pool.Get()
+	pool.Put(v1)
+	pool.Put(v2) // equal items are matched by value
+	pool.Put(v1)
+	pool.Put(5)
+
+	if len(misused) != 2 || misused[0] != ErrDoublePut || misused[1] != ErrForeignPut {
+		t.Error("Expected misuse to be reported", misused)
+		t.FailNow()
+	}
+
+	if raw.current != 2 || raw.inuse != 0 || len(raw.idle) != 2 {
+		t.Error("Expected rejected items to be ignored", raw.current, raw.inuse, len(raw.idle))
+		t.FailNow()
+	}
+}
+
+func TestBasicUnlimitedPool_LeakDetection(t *testing.T) {
+	pool, err := New(func(context.Context) ([]int, error) {
+		return []int{1}, nil
+	}, WithLeakDetection(0))
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+
+	lease, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Error("Errror is not expected", err)
+		t.FailNow()
+	}
+	if borrows := pool.Borrows(); len(borrows) != 1 || !strings.HasPrefix(borrows[0].Stack, poolPackage+"TestBasicUnlimitedPool_LeakDetection\n") {
+		t.Error("Expected non-comparable leased item to be recorded", borrows)
+		t.FailNow()
+	}
+	lease.Release()
+	if borrows := pool.Borrows(); len(borrows) != 0 {
+		t.Error("Expected released item to be forgotten", borrows)
+		t.FailNow()
+	}
+
+	pool.Close(context.Background())
+}
@@ -0,0 +1,98 @@
+package mpool
+
+import (
+	"sort"
+	"time"
+)
+
+// takeUnchecked takes idle items which are due for background validation,
+// items checked longest ago go first. It must be called with mu held.
+func (pool *base[T]) takeUnchecked(now time.Time) []*entry[T] {
+	if pool.validateEvery <= 0 || pool.check == nil || now.Sub(pool.validated) < pool.validateEvery {
+		return nil
+	}
+	pool.validated = now
+
+	var due []*entry[T]
+	for _, e := range pool.idle {
+		if now.Sub(e.checked) >= pool.validateEvery {
+			due = append(due, e)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].checked.Before(due[j].checked)
+	})
+	if uint(len(due)) > pool.validateCount {
+		due = due[:pool.validateCount]
+	}
+
+	taken := make(map[*entry[T]]bool, len(due))
+	for _, e := range due {
+		taken[e] = true
+	}
+	idle := pool.idle[:0]
+	for _, e := range pool.idle {
+		if !taken[e] {
+			idle = append(idle, e)
+		}
+	}
+	for i := len(idle); i < len(pool.idle); i++ {
+		pool.idle[i] = nil
+	}
+	pool.idle = idle
+	return due
+}
+
+// validateIdle checks idle items taken by takeUnchecked, valid items are
+// returned to the pool and failed ones are released, so refill can replace
+// them. Items keep their slots while they are checked.
+func (pool *base[T]) validateIdle(due []*entry[T]) {
+	passed := make([]bool, len(due))
+	for i, e := range due {
+		passed[i] = pool.valid(e)
+	}
+
+	pool.mu.Lock()
+	now := pool.now()
+	var removed []removal[T]
+	for i, e := range due {
+		switch {
+		case pool.closed:
+			removed = append(removed, removal[T]{e: e, reason: DestroyClosed})
+		case !passed[i]:
+			removed = append(removed, removal[T]{e: e, reason: DestroyCheckFailed})
+		default:
+			e.checked = now
+			pool.insertIdle(e)
+			continue
+		}
+		pool.current--
+	}
+	for _, e := range pool.takeExcess() {
+		removed = append(removed, removal[T]{e: e, reason: DestroyIdleFull})
+	}
+	pool.notify()
+	pool.mu.Unlock()
+
+	pool.dropAll(removed)
+}
+
+// insertIdle puts validated item back to its place in idle list, so the list
+// stays ordered by since, it must be called with mu held
+func (pool *base[T]) insertIdle(e *entry[T]) {
+	i := sort.Search(len(pool.idle), func(i int) bool {
+		return pool.idle[i].since.After(e.since)
+	})
+	pool.idle = append(pool.idle, nil)
+	copy(pool.idle[i+1:], pool.idle[i:])
+	pool.idle[i] = e
+}
+
+// checked reports if idle item was validated in background recently enough
+// to skip check on Get
+func (pool *base[T]) checked(e *entry[T]) bool {
+	return pool.skipValidated && !e.checked.IsZero() && pool.now().Sub(e.checked) < pool.validateEvery
+}